@@ -24,6 +24,7 @@ const (
 	modeSamba = "samba"
 	modeNTFS  = "ntfs"
 	modeSDDL  = "sddl"
+	modeCIFS  = "cifs"
 )
 
 const (
@@ -36,10 +37,12 @@ var (
 	destinationFilename  string
 	sourceAttribute      string
 	destinationAttribute string
+	sourceTDB            string
 	value                string
 	inputMode            string
 	outputMode           string
 	encoding             string
+	securityInfo         string
 	raw                  bool
 )
 
@@ -49,9 +52,11 @@ const (
 	destinationFilenameUsage  = "File to write ACL output data to (outputs to stdout if omitted)"
 	sourceAttributeUsage      = "Name of extended attribute in source file"
 	destinationAttributeUsage = "Name of extended attribute in destination file"
-	inputModeUsage            = "Format of input data (samba, ntfs, sddl)"
-	outputModeUsage           = "Format of output data (samba, ntfs, sddl)"
+	sourceTDBUsage            = "Samba xattr_tdb database to read samba input from instead of the source file"
+	inputModeUsage            = "Format of input data (samba, ntfs, cifs, sddl)"
+	outputModeUsage           = "Format of output data (samba, ntfs, cifs, sddl)"
 	encodingUsage             = "Encoding of output data (b64, hex)"
+	securityInfoUsage         = "Parts of the security descriptor to read or write in cifs mode (owner, group, dacl, sacl)"
 	rawUsage                  = "Performs a raw copy of the bytes instead of interpreting them"
 	shorthand                 = " (shorthand)"
 	usage                     = `Usage of acl.exe:
@@ -60,9 +65,12 @@ const (
   -t, -to:             File to write ACL attribute to (stdout if omitted)
   -sa:                 Name of extended attribute in source file
   -da:                 Name of extended attribute in destination file
-  -i, -in, -input:     Format of input data (samba, ntfs, sddl)
-  -o, -out, -output:   Format of output data (samba, ntfs, sddl)
+  -tdb:                Samba xattr_tdb database to read samba input from
+  -i, -in, -input:     Format of input data (samba, ntfs, cifs, sddl)
+  -o, -out, -output:   Format of output data (samba, ntfs, cifs, sddl)
   -e, -enc, -encoding: Encoding of output data (b64 [default], hex)
+  -si:                 Parts of the security descriptor to read or write in
+                       cifs mode (owner,group,dacl [default], sacl)
 	-raw:                Performs a raw copy of the bytes instead of interpreting them`
 )
 
@@ -75,6 +83,7 @@ func init() {
 	flag.StringVar(&destinationFilename, "t", "", destinationFilenameUsage+shorthand)
 	flag.StringVar(&sourceAttribute, "sa", "", sourceAttributeUsage)
 	flag.StringVar(&destinationAttribute, "da", "", destinationAttributeUsage)
+	flag.StringVar(&sourceTDB, "tdb", "", sourceTDBUsage)
 	flag.StringVar(&inputMode, "input", "", inputModeUsage)
 	flag.StringVar(&inputMode, "in", "", inputModeUsage+shorthand)
 	flag.StringVar(&inputMode, "i", "", inputModeUsage+shorthand)
@@ -84,9 +93,31 @@ func init() {
 	flag.StringVar(&encoding, "encoding", "", encodingUsage)
 	flag.StringVar(&encoding, "enc", "", encodingUsage+shorthand)
 	flag.StringVar(&encoding, "e", "", encodingUsage+shorthand)
+	flag.StringVar(&securityInfo, "si", "owner,group,dacl", securityInfoUsage)
 	flag.BoolVar(&raw, "raw", false, rawUsage)
 }
 
+// parseSecurityInformation converts a comma separated list of security
+// descriptor parts into security information flags.
+func parseSecurityInformation(s string) (info ntsecurity.SecurityInformation, err error) {
+	for _, part := range strings.Split(s, ",") {
+		switch strings.TrimSpace(part) {
+		case "owner":
+			info |= ntsecurity.OwnerSecurityInformation
+		case "group":
+			info |= ntsecurity.GroupSecurityInformation
+		case "dacl":
+			info |= ntsecurity.DACLSecurityInformation
+		case "sacl":
+			info |= ntsecurity.SACLSecurityInformation
+		case "":
+		default:
+			return 0, fmt.Errorf("Invalid security information: %s", part)
+		}
+	}
+	return info, nil
+}
+
 func main() {
 	flag.Parse()
 
@@ -95,11 +126,17 @@ func main() {
 	outputMode = strings.ToLower(outputMode)
 	encoding = strings.ToLower(encoding)
 
+	info, err := parseSecurityInformation(strings.ToLower(securityInfo))
+	if err != nil {
+		fmt.Println(err)
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+
 	// Step 1: Grab the raw security descriptor bytes
 	var (
 		inputBytes  []byte
 		outputBytes []byte
-		err         error
 	)
 
 	switch {
@@ -110,7 +147,7 @@ func main() {
 			os.Exit(1)
 		}
 		switch inputMode {
-		case modeNTFS, modeSamba:
+		case modeNTFS, modeCIFS, modeSamba:
 			// Autodetect encoding for these input modes
 			inputBytes, err = base64.StdEncoding.DecodeString(value)
 			if err != nil {
@@ -145,12 +182,35 @@ func main() {
 			if err != nil {
 				log.Fatal(err)
 			}
-		case modeSamba:
+		case modeCIFS:
 			if sourceAttribute == "" {
+				inputBytes, err = ntfs.ReadCIFSRawSD(sourceFilename, info)
+			} else {
+				inputBytes, err = ntfs.ReadFileAttribute(sourceFilename, sourceAttribute)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		case modeSamba:
+			if sourceTDB != "" {
+				var db *sambasecurity.XAttrTDB
+				if db, err = sambasecurity.OpenXAttrTDB(sourceTDB, os.O_RDONLY); err != nil {
+					log.Fatal(err)
+				}
+				if sourceAttribute == "" {
+					inputBytes, err = db.ReadFileRawSD(sourceFilename)
+				} else {
+					inputBytes, err = db.ReadFileAttribute(sourceFilename, sourceAttribute)
+				}
+				db.Close()
+			} else if sourceAttribute == "" {
 				inputBytes, err = sambasecurity.ReadFileRawSD(sourceFilename)
 			} else {
 				inputBytes, err = sambasecurity.ReadFileAttribute(sourceFilename, sourceAttribute)
 			}
+			if err != nil {
+				log.Fatal(err)
+			}
 		case modeSDDL:
 			fmt.Println("Invalid source mode while reading input from file attributes")
 			fmt.Println(usage)
@@ -165,7 +225,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	if raw && inputMode == outputMode && (inputMode == modeNTFS || inputMode == modeSamba) {
+	if raw && inputMode == outputMode && (inputMode == modeNTFS || inputMode == modeCIFS || inputMode == modeSamba) {
 		outputBytes = inputBytes
 	} else {
 		var sd ntsecurity.SecurityDescriptor
@@ -173,7 +233,7 @@ func main() {
 
 		// Step 2: Unmarshal the input
 		switch inputMode {
-		case modeNTFS:
+		case modeNTFS, modeCIFS:
 			err = sd.UnmarshalBinary(inputBytes)
 			if err != nil {
 				log.Fatal(err)
@@ -192,7 +252,7 @@ func main() {
 		switch outputMode {
 		case modeSDDL:
 			outputBytes = []byte(sd.SDDL())
-		case modeNTFS:
+		case modeNTFS, modeCIFS:
 			if outputBytes, err = sd.MarshalBinary(); err != nil {
 				log.Fatal(err)
 			}
@@ -228,6 +288,16 @@ func main() {
 				log.Fatal(err)
 			}
 			os.Exit(0)
+		case modeCIFS:
+			if destinationAttribute == "" {
+				err = ntfs.WriteCIFSRawSD(destinationFilename, outputBytes, info)
+			} else {
+				err = ntfs.WriteFileAttribute(destinationFilename, destinationAttribute, outputBytes)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			os.Exit(0)
 		case modeSamba:
 			if destinationAttribute == "" {
 				err = sambasecurity.WriteFileRawSD(destinationFilename, outputBytes)
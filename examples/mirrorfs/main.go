@@ -27,6 +27,12 @@ func main() {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, os.Kill, syscall.SIGQUIT)
 
+	var links mirrorfs.LinkPolicy
+	flag.Var(&links, "links", "how to present symbolic links that point outside of SOURCEPATH (show|hide|rewrite)")
+	attrTTL := flag.Duration("attr-ttl", mirrorfs.DefaultAttrTTL, "how long the kernel may cache file attributes")
+	entryTTL := flag.Duration("entry-ttl", mirrorfs.DefaultEntryTTL, "how long the kernel may cache the results of name lookups")
+	watch := flag.Bool("watch", false, "watch SOURCEPATH for changes made other than through the mount and discard them from the kernel caches")
+	poll := flag.Duration("poll", mirrorfs.DefaultPollInterval, "with -watch, how often to check the files known to the kernel for changes that inotify cannot see, such as those made through another mount of the volume (0 disables)")
 	flag.Usage = usage
 	flag.Parse()
 
@@ -51,7 +57,21 @@ func main() {
 		}
 	}()
 
-	if err := mirrorfs.Mount(path, mountpoint, "mirrorfs", "mirrorfs", "mirrorfs", mirrorfs.NewFS); err != nil {
+	root, err := mirrorfs.New(path, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	root.Links = links
+	root.AttrTTL = *attrTTL
+	root.EntryTTL = *entryTTL
+	root.PollInterval = *poll
+	if *watch {
+		if err := root.Watch(); err != nil {
+			// The mount still works, only with the kernel caches alone
+			log.Printf("Not watching %s for changes: %v", path, err)
+		}
+	}
+	if err := mirrorfs.Serve(root, mountpoint, "mirrorfs", "mirrorfs", "mirrorfs"); err != nil {
 		log.Fatal(err)
 	}
 }
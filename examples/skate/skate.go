@@ -19,6 +19,7 @@ import (
 const (
 	modeSamba = "samba"
 	modeNTFS  = "ntfs"
+	modeCIFS  = "cifs"
 	modeSDDL  = "sddl"
 
 	encBase64 = "b64"
@@ -37,11 +38,15 @@ var (
 	xattrSamba *string
 )
 
+// cifsInfo is the part of the security descriptor read from a CIFS mount,
+// which does not require any privilege on the server.
+const cifsInfo = ntsecurity.OwnerSecurityInformation | ntsecurity.GroupSecurityInformation | ntsecurity.DACLSecurityInformation
+
 func main() {
 	if runtime.GOOS == "windows" {
 		*source = "ntfs"
 	} else {
-		source = flag.String("source", "auto", "Source is (ntfs|samba|auto)")
+		source = flag.String("source", "auto", "Source is (ntfs|cifs|samba|auto)")
 		xattrNTFS = flag.String("xattrNTFS", "system.ntfs_acl", "Extended attribute to read from NTFS")
 		xattrSamba = flag.String("xattrSamba", "security.NTACL", "Extended attribute to read from Samba")
 	}
@@ -65,9 +70,9 @@ func main() {
 	}
 
 	*source = strings.ToLower(*source)
-	if *source != "auto" && *source != "ntfs" && *source != "samba" {
+	if *source != "auto" && *source != "ntfs" && *source != "cifs" && *source != "samba" {
 		flag.Usage()
-		log.Fatal("-source must be one of: ntfs, samba, auto")
+		log.Fatal("-source must be one of: ntfs, cifs, samba, auto")
 	}
 
 	iChan = counter()
@@ -170,6 +175,22 @@ func process(fp string) {
 				log.Printf("Error on NTFS file %s: %s\n", fp, err)
 			}
 		}
+		if *source == "cifs" || (*source == "auto" && sdBytes == nil) {
+			sdBytes, err = ntfs.ReadCIFSRawSD(fp, cifsInfo)
+			if err == nil {
+				var sd ntsecurity.SecurityDescriptor
+				if err := sd.UnmarshalBinary(sdBytes); err != nil {
+					log.Printf("Error parsing CIFS security descriptor of %s: %s\n", fp, err)
+				}
+				return
+			}
+			if os.IsNotExist(err) {
+				return
+			}
+			if *source == "cifs" {
+				log.Printf("Error on CIFS file %s: %s\n", fp, err)
+			}
+		}
 		if *source == "samba" || (*source == "auto" && sdBytes == nil) {
 			sdBytes, err = sambasecurity.ReadFileAttribute(fp, *xattrSamba)
 			if err == nil {
@@ -188,7 +209,7 @@ func process(fp string) {
 			}
 			// FIXME: should we complain that we got to this point?
 		}
-		// something went wrong?  file neither samba nor ntfs?
+		// something went wrong?  file neither samba, cifs nor ntfs?
 		log.Printf("No action on %s\n", fp)
 	}
 	return
@@ -0,0 +1,108 @@
+package idmap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+var errRangeExhausted = errors.New("All IDs in the range have been allocated")
+
+// Allocator maps SIDs that no other backend maps by allocating the next free
+// ID of the requested type from a range, in the way that Samba's idmap_tdb
+// backend does. It is meant to be placed at the end of a Chain, and its range
+// must not overlap the IDs mapped by the other backends.
+//
+// The allocations are recorded in a mapping file in the format read by
+// LoadStatic, so that they remain stable and can later be turned into static
+// mappings.
+type Allocator struct {
+	Range Range
+
+	mu     sync.Mutex
+	file   *os.File // Records allocations, or nil
+	static *Static
+	next   [2]uint64 // The next ID of each type to consider
+}
+
+// NewAllocator returns an allocator for the given range of IDs. The
+// allocations are read from and recorded in the mapping file at path, which
+// is created if necessary. When path is empty the allocations are not
+// recorded.
+func NewAllocator(r Range, path string) (*Allocator, error) {
+	a := &Allocator{
+		Range:  r,
+		static: NewStatic(),
+		next:   [2]uint64{uint64(r.Low), uint64(r.Low)},
+	}
+	if path == "" {
+		return a, nil
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.static.read(file, path); err != nil {
+		file.Close()
+		return nil, err
+	}
+	a.file = file
+	return a, nil
+}
+
+// Close closes the file that allocations are recorded in.
+func (a *Allocator) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+func (a *Allocator) ID(sid ntsecurity.SID, typ IDType) (uint32, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if typ != UserID && typ != GroupID {
+		return 0, ErrNotMapped
+	}
+	if id, err := a.static.ID(sid, typ); err == nil {
+		return id, nil
+	}
+	next := a.next[typ]
+	for ; next <= uint64(a.Range.High); next++ {
+		if _, err := a.static.SID(uint32(next), typ); err == ErrNotMapped {
+			break
+		}
+	}
+	if next > uint64(a.Range.High) {
+		return 0, errRangeExhausted
+	}
+	id := uint32(next)
+	if a.file != nil {
+		if _, err := fmt.Fprintf(a.file, "%s %s %d\n", sid, typ, id); err != nil {
+			return 0, err
+		}
+		if err := a.file.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	a.static.Add(sid, typ, id)
+	a.next[typ] = next + 1
+	return id, nil
+}
+
+// mapped returns the ID that the SID has been allocated, if any.
+func (a *Allocator) mapped(sid ntsecurity.SID, typ IDType) (uint32, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	id, err := a.static.ID(sid, typ)
+	return id, err == nil
+}
+
+func (a *Allocator) SID(id uint32, typ IDType) (ntsecurity.SID, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.static.SID(id, typ)
+}
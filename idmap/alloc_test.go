@@ -0,0 +1,59 @@
+package idmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+func TestAllocator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alloc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alloc")
+	// An ID that is already taken is skipped
+	if err = ioutil.WriteFile(path, []byte("S-1-5-21-1-2-3-500 uid 10000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAllocator(Range{Low: 10000, High: 10002}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		sid string
+		typ IDType
+		id  uint32
+	}{
+		{"S-1-5-21-1-2-3-500", UserID, 10000},
+		{"S-1-5-21-1-2-3-1104", UserID, 10001},
+		{"S-1-5-21-1-2-3-513", GroupID, 10000},
+		{"S-1-5-21-1-2-3-1105", UserID, 10002},
+		{"S-1-5-21-1-2-3-1104", UserID, 10001},
+	} {
+		if id, err := a.ID(ntsecurity.MustParseSID(test.sid), test.typ); id != test.id || err != nil {
+			t.Errorf("ID(%s, %v) = %d, %v, want %d", test.sid, test.typ, id, err, test.id)
+		}
+	}
+	if _, err := a.ID(ntsecurity.MustParseSID("S-1-5-21-1-2-3-1106"), UserID); err != errRangeExhausted {
+		t.Errorf("ID with every uid allocated returned %v", err)
+	}
+	a.Close()
+
+	// The allocations are read back from the file
+	if a, err = NewAllocator(Range{Low: 10000, High: 10002}, path); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if sid, err := a.SID(10002, UserID); err != nil || sid.String() != "S-1-5-21-1-2-3-1105" {
+		t.Errorf("SID(10002) = %s, %v after reloading", sid, err)
+	}
+	if id, err := a.ID(ntsecurity.MustParseSID("S-1-5-21-1-2-3-1107"), GroupID); id != 10001 || err != nil {
+		t.Errorf("ID after reloading = %d, %v, want gid 10001", id, err)
+	}
+}
@@ -0,0 +1,205 @@
+package idmap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// DefaultRangeSize is the number of IDs in each range of an AutoRID backend
+// unless configured otherwise. It matches the default of Samba.
+const DefaultRangeSize = 100000
+
+var (
+	errInvalidRangeSize = errors.New("Range size must be nonzero and no larger than the ID range")
+	errRangesExhausted  = errors.New("All ID ranges have been allocated")
+)
+
+// AutoRID maps the SIDs of any number of domains to Unix IDs, using the
+// algorithm of Samba's idmap_autorid backend.
+//
+// The ID range is divided into ranges of RangeSize IDs. Each domain is
+// allocated the next free range when one of its SIDs is first mapped, and the
+// SIDs of the domain are mapped by their relative identifiers:
+//
+//	id = Range.Low + range*RangeSize + rid%RangeSize
+//
+// Domains with relative identifiers of RangeSize or more are allocated an
+// additional range for each multiple of RangeSize. User and group IDs are
+// mapped alike.
+//
+// Which domain each range belongs to is recorded in a file, so that the
+// mapping remains stable. The same file must not be shared with Samba, whose
+// allocations are stored in a database of a different format.
+type AutoRID struct {
+	Range     Range
+	RangeSize uint32
+
+	mu      sync.Mutex
+	file    *os.File          // Records allocations, or nil
+	ranges  map[string]uint32 // By domain key
+	domains map[uint32]string // By range
+	next    uint32
+}
+
+// NewAutoRID returns an AutoRID backend for the given range of IDs. The
+// allocations are read from and recorded in the file at path, which is
+// created if necessary. When path is empty the allocations are not recorded.
+func NewAutoRID(r Range, rangeSize uint32, path string) (*AutoRID, error) {
+	if rangeSize == 0 || uint64(rangeSize) > r.Size() {
+		return nil, errInvalidRangeSize
+	}
+	b := &AutoRID{
+		Range:     r,
+		RangeSize: rangeSize,
+		ranges:    make(map[string]uint32),
+		domains:   make(map[uint32]string),
+	}
+	if path == "" {
+		return b, nil
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.load(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	b.file = file
+	return b, nil
+}
+
+// load reads allocations in the format written by allocate: the range
+// number followed by the domain key on each line.
+func (b *AutoRID) load(file *os.File) error {
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: Invalid range allocation", file.Name(), line)
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil || uint64(n) >= b.rangeCount() {
+			return fmt.Errorf("%s:%d: Invalid range number", file.Name(), line)
+		}
+		b.ranges[fields[1]] = uint32(n)
+		b.domains[uint32(n)] = fields[1]
+		if uint32(n) >= b.next {
+			b.next = uint32(n) + 1
+		}
+	}
+	return scanner.Err()
+}
+
+// Close closes the file that allocations are recorded in.
+func (b *AutoRID) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	return b.file.Close()
+}
+
+func (b *AutoRID) rangeCount() uint64 {
+	return b.Range.Size() / uint64(b.RangeSize)
+}
+
+// domainKey identifies the range of a domain that holds the given relative
+// identifier, in the same notation as Samba.
+func (b *AutoRID) domainKey(domain ntsecurity.SID, rid uint32) string {
+	key := domain.String()
+	if index := rid / b.RangeSize; index > 0 {
+		key += "#" + strconv.FormatUint(uint64(index), 10)
+	}
+	return key
+}
+
+// allocate returns the range of the domain key, allocating the next free range
+// if it has none yet.
+func (b *AutoRID) allocate(key string) (uint32, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n, ok := b.ranges[key]; ok {
+		return n, nil
+	}
+	if uint64(b.next) >= b.rangeCount() {
+		return 0, errRangesExhausted
+	}
+	n := b.next
+	if b.file != nil {
+		if _, err := fmt.Fprintf(b.file, "%d %s\n", n, key); err != nil {
+			return 0, err
+		}
+		if err := b.file.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	b.next++
+	b.ranges[key] = n
+	b.domains[n] = key
+	return n, nil
+}
+
+func (b *AutoRID) ID(sid ntsecurity.SID, typ IDType) (uint32, error) {
+	domain, rid, ok := splitRID(sid)
+	if !ok {
+		return 0, ErrNotMapped
+	}
+	n, err := b.allocate(b.domainKey(domain, rid))
+	if err != nil {
+		return 0, err
+	}
+	return b.Range.Low + n*b.RangeSize + rid%b.RangeSize, nil
+}
+
+// mapped returns the ID that the SID maps to if its domain has been
+// allocated a range.
+func (b *AutoRID) mapped(sid ntsecurity.SID, typ IDType) (uint32, bool) {
+	domain, rid, ok := splitRID(sid)
+	if !ok {
+		return 0, false
+	}
+	b.mu.Lock()
+	n, ok := b.ranges[b.domainKey(domain, rid)]
+	b.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	return b.Range.Low + n*b.RangeSize + rid%b.RangeSize, true
+}
+
+func (b *AutoRID) SID(id uint32, typ IDType) (ntsecurity.SID, error) {
+	if !b.Range.Contains(id) {
+		return ntsecurity.SID{}, ErrNotMapped
+	}
+	offset := id - b.Range.Low
+	b.mu.Lock()
+	key, ok := b.domains[offset/b.RangeSize]
+	b.mu.Unlock()
+	if !ok {
+		return ntsecurity.SID{}, ErrNotMapped
+	}
+	var index uint64
+	if i := strings.IndexByte(key, '#'); i >= 0 {
+		index, _ = strconv.ParseUint(key[i+1:], 10, 32)
+		key = key[:i]
+	}
+	domain, err := ntsecurity.ParseSID(key)
+	if err != nil {
+		return ntsecurity.SID{}, ErrNotMapped
+	}
+	rid := index*uint64(b.RangeSize) + uint64(offset%b.RangeSize)
+	if rid > 0xFFFFFFFF {
+		return ntsecurity.SID{}, ErrNotMapped
+	}
+	return joinRID(domain, uint32(rid)), nil
+}
@@ -0,0 +1,90 @@
+package idmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+func TestAutoRID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autorid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "autorid")
+
+	b, err := NewAutoRID(Range{Low: 100000, High: 399999}, 100000, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		sid string
+		id  uint32
+	}{
+		{"S-1-5-21-1004336348-1177238915-682003330-1104", 101104},
+		{"S-1-5-21-1-2-3-500", 200500},
+		// A relative identifier beyond the range size is given another range
+		{"S-1-5-21-1004336348-1177238915-682003330-101104", 301104},
+		{"S-1-5-21-1004336348-1177238915-682003330-513", 100513},
+	} {
+		if id, err := b.ID(ntsecurity.MustParseSID(test.sid), UserID); id != test.id || err != nil {
+			t.Errorf("ID(%s) = %d, %v, want %d", test.sid, id, err, test.id)
+		}
+	}
+	if _, err := b.ID(ntsecurity.MustParseSID("S-1-5-21-4-5-6-500"), UserID); err != errRangesExhausted {
+		t.Errorf("ID with every range allocated returned %v", err)
+	}
+	b.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "0 S-1-5-21-1004336348-1177238915-682003330\n1 S-1-5-21-1-2-3\n2 S-1-5-21-1004336348-1177238915-682003330#1\n"
+	if string(data) != want {
+		t.Errorf("Recorded\n%s\nwant\n%s", data, want)
+	}
+
+	// The ranges are read back, and keys with an index map back to SIDs
+	// beyond the range size
+	if b, err = NewAutoRID(Range{Low: 100000, High: 399999}, 100000, path); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if sid, err := b.SID(301104, GroupID); err != nil || sid.String() != "S-1-5-21-1004336348-1177238915-682003330-101104" {
+		t.Errorf("SID(301104) = %s, %v after reloading", sid, err)
+	}
+	if id, err := b.ID(ntsecurity.MustParseSID("S-1-5-21-1-2-3-7"), GroupID); id != 200007 || err != nil {
+		t.Errorf("ID after reloading = %d, %v, want 200007", id, err)
+	}
+	// Range 2 is allocated, so every ID in it maps back to a SID
+	if _, err := b.SID(399999, UserID); err != nil {
+		t.Errorf("SID(399999) returned %v", err)
+	}
+}
+
+func TestAutoRIDInvalid(t *testing.T) {
+	if _, err := NewAutoRID(Range{Low: 1000, High: 1999}, 2000, ""); err != errInvalidRangeSize {
+		t.Errorf("NewAutoRID with a range size larger than the range returned %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "autorid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i, text := range []string{"3 S-1-5-21-1-2-3\n", "0\n", "x S-1-5-21-1-2-3\n"} {
+		path := filepath.Join(dir, strings.Repeat("x", i+1))
+		if err = ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewAutoRID(Range{Low: 100000, High: 399999}, 100000, path); err == nil {
+			t.Errorf("Loaded %q without an error", text)
+		}
+	}
+}
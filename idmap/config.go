@@ -0,0 +1,103 @@
+package idmap
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+var errInvalidSpec = errors.New("Backend must be one of: rid:DOMAINSID:LOW-HIGH[:BASERID], autorid:LOW-HIGH[:RANGESIZE[:FILE]], static:FILE, alloc:LOW-HIGH[:FILE], ntfs3g:VOLUME")
+
+// Parse returns the backend described by a specification of one of the
+// following forms, in which FILE is the file that mappings are read from or
+// recorded in:
+//
+//	rid:DOMAINSID:LOW-HIGH[:BASERID]
+//	autorid:LOW-HIGH[:RANGESIZE[:FILE]]
+//	static:FILE
+//	alloc:LOW-HIGH[:FILE]
+//	ntfs3g:VOLUME
+func Parse(spec string) (Backend, error) {
+	i := strings.IndexByte(spec, ':')
+	if i < 0 {
+		return nil, errInvalidSpec
+	}
+	kind, args := spec[:i], spec[i+1:]
+	switch kind {
+	case "rid":
+		parts := strings.Split(args, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, errInvalidSpec
+		}
+		domain, err := ntsecurity.ParseSID(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		r, err := ParseRange(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		var base uint64
+		if len(parts) == 3 {
+			if base, err = strconv.ParseUint(parts[2], 10, 32); err != nil {
+				return nil, errInvalidSpec
+			}
+		}
+		return &RID{Domain: domain, Range: r, BaseRID: uint32(base)}, nil
+	case "autorid":
+		parts := strings.SplitN(args, ":", 3)
+		r, err := ParseRange(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(DefaultRangeSize)
+		if len(parts) > 1 && parts[1] != "" {
+			if size, err = strconv.ParseUint(parts[1], 10, 32); err != nil {
+				return nil, errInvalidSpec
+			}
+		}
+		var path string
+		if len(parts) > 2 {
+			path = parts[2]
+		}
+		return NewAutoRID(r, uint32(size), path)
+	case "static":
+		return LoadStatic(args)
+	case "alloc":
+		parts := strings.SplitN(args, ":", 2)
+		r, err := ParseRange(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		var path string
+		if len(parts) > 1 {
+			path = parts[1]
+		}
+		return NewAllocator(r, path)
+	case "ntfs3g":
+		return LoadNTFS3G(args)
+	default:
+		return nil, errInvalidSpec
+	}
+}
+
+func (c *Chain) String() string {
+	if len(*c) == 0 {
+		return ""
+	}
+	return strconv.Itoa(len(*c)) + " backends"
+}
+
+// Set appends the backend described by the specification to the chain, which
+// allows a chain to be configured by repeating a command line flag. See Parse
+// for the form of the specification.
+func (c *Chain) Set(spec string) error {
+	b, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, b)
+	return nil
+}
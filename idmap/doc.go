@@ -0,0 +1,10 @@
+/*
+Package idmap maps NT security identifiers (SIDs) to Unix user and group IDs
+and back.
+
+Mappings are provided by backends, which implement the algorithms of the
+identity mapping backends of Samba's winbind so that files are presented with
+the same owners that a Samba server in the same domain would use. Backends are
+combined with a Chain, which consults each of them in turn.
+*/
+package idmap
@@ -0,0 +1,130 @@
+package idmap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// IDType distinguishes Unix user IDs from group IDs.
+type IDType int
+
+const (
+	UserID IDType = iota
+	GroupID
+)
+
+func (t IDType) String() string {
+	switch t {
+	case UserID:
+		return "uid"
+	case GroupID:
+		return "gid"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrNotMapped is returned by a backend that has no mapping for an identity.
+var ErrNotMapped = errors.New("Identity is not mapped")
+
+var errInvalidRange = errors.New("Invalid ID range")
+
+// Backend maps security identifiers to Unix user and group IDs and back.
+type Backend interface {
+	// ID returns the Unix ID of the given type that the SID maps to.
+	ID(sid ntsecurity.SID, typ IDType) (uint32, error)
+
+	// SID returns the SID that the Unix ID of the given type maps to.
+	SID(id uint32, typ IDType) (ntsecurity.SID, error)
+}
+
+// Chain is a backend that consults each of its backends in turn, in the way
+// that winbind consults the backends configured for specific domains before
+// its default backend. The first backend that maps an identity is used, and
+// the first error other than ErrNotMapped is returned.
+type Chain []Backend
+
+func (c Chain) ID(sid ntsecurity.SID, typ IDType) (uint32, error) {
+	for _, b := range c {
+		id, err := b.ID(sid, typ)
+		if err != ErrNotMapped {
+			return id, err
+		}
+	}
+	return 0, ErrNotMapped
+}
+
+func (c Chain) SID(id uint32, typ IDType) (ntsecurity.SID, error) {
+	for _, b := range c {
+		sid, err := b.SID(id, typ)
+		if err != ErrNotMapped {
+			return sid, err
+		}
+	}
+	return ntsecurity.SID{}, ErrNotMapped
+}
+
+// Range is an inclusive range of Unix IDs.
+type Range struct {
+	Low  uint32
+	High uint32
+}
+
+// ParseRange parses a range in the LOW-HIGH notation used by the range
+// option of Samba's idmap configuration.
+func ParseRange(s string) (r Range, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return r, errInvalidRange
+	}
+	low, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 32)
+	if err != nil {
+		return r, errInvalidRange
+	}
+	high, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32)
+	if err != nil || high < low {
+		return r, errInvalidRange
+	}
+	return Range{Low: uint32(low), High: uint32(high)}, nil
+}
+
+// Contains returns true if the ID lies within the range.
+func (r Range) Contains(id uint32) bool {
+	return id >= r.Low && id <= r.High
+}
+
+// Size returns the number of IDs in the range.
+func (r Range) Size() uint64 {
+	return uint64(r.High) - uint64(r.Low) + 1
+}
+
+func (r Range) String() string {
+	return fmt.Sprintf("%d-%d", r.Low, r.High)
+}
+
+// splitRID separates the relative identifier, which is the final
+// sub-authority of the SID, from the SID of the domain that it belongs to.
+func splitRID(sid ntsecurity.SID) (domain ntsecurity.SID, rid uint32, ok bool) {
+	count := len(sid.SubAuthority)
+	if count == 0 {
+		return domain, 0, false
+	}
+	domain = sid
+	domain.SubAuthority = sid.SubAuthority[: count-1 : count-1]
+	domain.SubAuthorityCount = uint8(count - 1)
+	return domain, sid.SubAuthority[count-1], true
+}
+
+// joinRID returns the SID of the relative identifier within the domain.
+func joinRID(domain ntsecurity.SID, rid uint32) ntsecurity.SID {
+	sid := domain
+	sid.SubAuthority = make([]uint32, len(domain.SubAuthority)+1)
+	copy(sid.SubAuthority, domain.SubAuthority)
+	sid.SubAuthority[len(domain.SubAuthority)] = rid
+	sid.SubAuthorityCount = uint8(len(sid.SubAuthority))
+	return sid
+}
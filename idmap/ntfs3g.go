@@ -0,0 +1,63 @@
+package idmap
+
+import (
+	"os"
+	"path/filepath"
+
+	"go.scj.io/samba-over-ntfs/ntfs"
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// NTFS3G maps SIDs according to the user mapping of the ntfs-3g driver, so
+// that the identities presented through Samba are consistent with those that
+// ntfs-3g applies to the same volume.
+//
+// ntfs-3g maps every SID, to root when no other mapping applies, so a backend
+// with an active mapping never returns ErrNotMapped for a SID and belongs at
+// the end of a Chain. A backend whose mapping is not active maps nothing,
+// since ntfs-3g ignores such a mapping.
+type NTFS3G struct {
+	Mapping *ntfs.UserMapping
+}
+
+// LoadNTFS3G reads the user mapping file of the NTFS volume mounted at the
+// given path.
+func LoadNTFS3G(volume string) (*NTFS3G, error) {
+	file, err := os.Open(filepath.Join(volume, ntfs.UserMappingPath))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	mapping, err := ntfs.ReadUserMapping(file)
+	if err != nil {
+		return nil, err
+	}
+	return &NTFS3G{Mapping: mapping}, nil
+}
+
+func (b *NTFS3G) ID(sid ntsecurity.SID, typ IDType) (uint32, error) {
+	if !b.Mapping.Active() {
+		return 0, ErrNotMapped
+	}
+	if typ == GroupID {
+		return b.Mapping.GID(sid), nil
+	}
+	return b.Mapping.UID(sid), nil
+}
+
+func (b *NTFS3G) SID(id uint32, typ IDType) (ntsecurity.SID, error) {
+	if !b.Mapping.Active() {
+		return ntsecurity.SID{}, ErrNotMapped
+	}
+	var sid ntsecurity.SID
+	var ok bool
+	if typ == GroupID {
+		sid, ok = b.Mapping.GroupSID(id)
+	} else {
+		sid, ok = b.Mapping.UserSID(id)
+	}
+	if !ok {
+		return ntsecurity.SID{}, ErrNotMapped
+	}
+	return sid, nil
+}
@@ -0,0 +1,39 @@
+package idmap
+
+import "go.scj.io/samba-over-ntfs/ntsecurity"
+
+// RID maps the SIDs of a single domain to Unix IDs by their relative
+// identifiers, using the algorithm of Samba's idmap_rid backend:
+//
+//	id = rid - BaseRID + Range.Low
+//
+// User and group IDs are mapped alike. SIDs of other domains, and relative
+// identifiers that would fall outside of the range, are not mapped.
+type RID struct {
+	Domain  ntsecurity.SID
+	Range   Range
+	BaseRID uint32
+}
+
+func (b *RID) ID(sid ntsecurity.SID, typ IDType) (uint32, error) {
+	domain, rid, ok := splitRID(sid)
+	if !ok || !domain.Equal(b.Domain) || rid < b.BaseRID {
+		return 0, ErrNotMapped
+	}
+	id := uint64(rid-b.BaseRID) + uint64(b.Range.Low)
+	if id > uint64(b.Range.High) {
+		return 0, ErrNotMapped
+	}
+	return uint32(id), nil
+}
+
+func (b *RID) SID(id uint32, typ IDType) (ntsecurity.SID, error) {
+	if !b.Range.Contains(id) {
+		return ntsecurity.SID{}, ErrNotMapped
+	}
+	rid := uint64(id-b.Range.Low) + uint64(b.BaseRID)
+	if rid > 0xFFFFFFFF {
+		return ntsecurity.SID{}, ErrNotMapped
+	}
+	return joinRID(b.Domain, uint32(rid)), nil
+}
@@ -0,0 +1,43 @@
+package idmap
+
+import (
+	"testing"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+func TestRID(t *testing.T) {
+	b := &RID{
+		Domain:  ntsecurity.MustParseSID("S-1-5-21-1004336348-1177238915-682003330"),
+		Range:   Range{Low: 10000, High: 19999},
+		BaseRID: 1000,
+	}
+	for _, test := range []struct {
+		sid string
+		id  uint32
+		err error
+	}{
+		{"S-1-5-21-1004336348-1177238915-682003330-1000", 10000, nil},
+		{"S-1-5-21-1004336348-1177238915-682003330-1104", 10104, nil},
+		{"S-1-5-21-1004336348-1177238915-682003330-10999", 19999, nil},
+		{"S-1-5-21-1004336348-1177238915-682003330-11000", 0, ErrNotMapped}, // Beyond the range
+		{"S-1-5-21-1004336348-1177238915-682003330-999", 0, ErrNotMapped},   // Below the base
+		{"S-1-5-21-1004336348-1177238915-682003331-1104", 0, ErrNotMapped},  // Another domain
+		{"S-1-5-32-544", 0, ErrNotMapped},
+	} {
+		sid := ntsecurity.MustParseSID(test.sid)
+		id, err := b.ID(sid, GroupID)
+		if id != test.id || err != test.err {
+			t.Errorf("ID(%s) = %d, %v, want %d, %v", test.sid, id, err, test.id, test.err)
+		}
+		if err != nil {
+			continue
+		}
+		if back, err := b.SID(id, UserID); err != nil || !back.Equal(sid) {
+			t.Errorf("SID(%d) = %s, %v, want %s", id, back, err, test.sid)
+		}
+	}
+	if _, err := b.SID(9999, UserID); err != ErrNotMapped {
+		t.Errorf("SID of an ID outside of the range returned %v", err)
+	}
+}
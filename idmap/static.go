@@ -0,0 +1,132 @@
+package idmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// Static maps SIDs to Unix IDs according to a fixed table, which is typically
+// read from a mapping file with LoadStatic.
+//
+// A mapping file lists one mapping on each line, consisting of a SID, the type
+// of the ID and the ID, separated by white space. The type is "uid", "gid" or
+// "both". Empty lines and lines starting with "#" are ignored:
+//
+//	# SID                                        type  id
+//	S-1-5-21-1004336348-1177238915-682003330-500 uid   0
+//	S-1-5-21-1004336348-1177238915-682003330-513 gid   100
+//	S-1-5-32-544                                 both  990
+//
+// When several SIDs map to the same ID, the ID maps back to the first of them.
+// A Static table must not be modified while it is in use.
+type Static struct {
+	ids  map[staticSID]uint32
+	sids map[staticID]ntsecurity.SID
+}
+
+type staticSID struct {
+	sid string
+	typ IDType
+}
+
+type staticID struct {
+	id  uint32
+	typ IDType
+}
+
+// NewStatic returns an empty table.
+func NewStatic() *Static {
+	return &Static{
+		ids:  make(map[staticSID]uint32),
+		sids: make(map[staticID]ntsecurity.SID),
+	}
+}
+
+// LoadStatic reads a table from the mapping file at path.
+func LoadStatic(path string) (*Static, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	s := NewStatic()
+	if err := s.read(file, path); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ReadStatic reads a table in the format of a mapping file.
+func ReadStatic(r io.Reader) (*Static, error) {
+	s := NewStatic()
+	if err := s.read(r, "mapping"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// read adds the mappings in the format of a mapping file to the table. The
+// name identifies the source in errors.
+func (s *Static) read(r io.Reader, name string) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 3 {
+			return fmt.Errorf("%s:%d: Invalid mapping", name, line)
+		}
+		sid, err := ntsecurity.ParseSID(fields[0])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		id, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s:%d: Invalid ID", name, line)
+		}
+		switch fields[1] {
+		case "uid":
+			s.Add(sid, UserID, uint32(id))
+		case "gid":
+			s.Add(sid, GroupID, uint32(id))
+		case "both":
+			s.Add(sid, UserID, uint32(id))
+			s.Add(sid, GroupID, uint32(id))
+		default:
+			return fmt.Errorf("%s:%d: Invalid ID type", name, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// Add maps the SID to the Unix ID of the given type. The ID only maps back to
+// the SID if it is not already mapped.
+func (s *Static) Add(sid ntsecurity.SID, typ IDType, id uint32) {
+	s.ids[staticSID{sid.String(), typ}] = id
+	if _, ok := s.sids[staticID{id, typ}]; !ok {
+		s.sids[staticID{id, typ}] = sid
+	}
+}
+
+func (s *Static) ID(sid ntsecurity.SID, typ IDType) (uint32, error) {
+	id, ok := s.ids[staticSID{sid.String(), typ}]
+	if !ok {
+		return 0, ErrNotMapped
+	}
+	return id, nil
+}
+
+func (s *Static) SID(id uint32, typ IDType) (ntsecurity.SID, error) {
+	sid, ok := s.sids[staticID{id, typ}]
+	if !ok {
+		return ntsecurity.SID{}, ErrNotMapped
+	}
+	return sid, nil
+}
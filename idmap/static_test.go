@@ -0,0 +1,52 @@
+package idmap
+
+import (
+	"strings"
+	"testing"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+func TestReadStatic(t *testing.T) {
+	s, err := ReadStatic(strings.NewReader(`# SID type id
+S-1-5-21-1004336348-1177238915-682003330-500 uid 0
+S-1-5-21-1004336348-1177238915-682003330-513 gid 100
+S-1-5-32-544 both 990
+S-1-5-32-545 gid 100
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		sid string
+		typ IDType
+		id  uint32
+		err error
+	}{
+		{"S-1-5-21-1004336348-1177238915-682003330-500", UserID, 0, nil},
+		{"S-1-5-21-1004336348-1177238915-682003330-500", GroupID, 0, ErrNotMapped},
+		{"S-1-5-21-1004336348-1177238915-682003330-513", GroupID, 100, nil},
+		{"S-1-5-32-544", UserID, 990, nil},
+		{"S-1-5-32-544", GroupID, 990, nil},
+		{"S-1-5-32-545", GroupID, 100, nil},
+	} {
+		if id, err := s.ID(ntsecurity.MustParseSID(test.sid), test.typ); id != test.id || err != test.err {
+			t.Errorf("ID(%s, %v) = %d, %v, want %d, %v", test.sid, test.typ, id, err, test.id, test.err)
+		}
+	}
+	// The first SID mapped to an ID is the one it maps back to
+	if sid, err := s.SID(100, GroupID); err != nil || sid.String() != "S-1-5-21-1004336348-1177238915-682003330-513" {
+		t.Errorf("SID(100) = %s, %v", sid, err)
+	}
+
+	for _, text := range []string{
+		"S-1-5-32-544 uid",
+		"S-1-5-32-544 user 0",
+		"S-1-5-32-544 uid -1",
+		"S-1-5-32 uid x",
+	} {
+		if _, err := ReadStatic(strings.NewReader(text)); err == nil {
+			t.Errorf("Read %q without an error", text)
+		}
+	}
+}
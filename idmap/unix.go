@@ -0,0 +1,119 @@
+package idmap
+
+import "go.scj.io/samba-over-ntfs/ntsecurity"
+
+// UnixIdentifierAuthority is the identifier authority of the SIDs that Samba
+// assigns to Unix users and groups that no backend maps, S-1-22-1-UID for
+// users and S-1-22-2-GID for groups.
+var UnixIdentifierAuthority = ntsecurity.IdentifierAuthority{0, 0, 0, 0, 0, 22}
+
+// The second sub-authorities of the Unix user and group SIDs.
+const (
+	unixUserRID  = 1
+	unixGroupRID = 2
+)
+
+// UnixSID returns the Unix user or group SID of the ID.
+func UnixSID(id uint32, typ IDType) ntsecurity.SID {
+	kind := uint32(unixUserRID)
+	if typ == GroupID {
+		kind = unixGroupRID
+	}
+	return ntsecurity.SID{
+		Revision:            1,
+		SubAuthorityCount:   2,
+		IdentifierAuthority: UnixIdentifierAuthority,
+		SubAuthority:        []uint32{kind, id},
+	}
+}
+
+// ResolveID returns the SID that the backend maps the ID to, or the Unix user
+// or group SID of the ID if the backend is nil or does not map it, as Samba
+// does.
+func ResolveID(b Backend, id uint32, typ IDType) ntsecurity.SID {
+	if b != nil {
+		if sid, err := b.SID(id, typ); err == nil {
+			return sid
+		}
+	}
+	return UnixSID(id, typ)
+}
+
+// ResolveSID returns the type and value of the ID that a SID of unknown type
+// stands for. Unix user and group SIDs stand for their IDs. Other SIDs are
+// mapped by the backend, which may be nil, to a uid if the uid maps back to
+// the same SID, and otherwise to a gid if that maps back to it, since some
+// backends map every SID to both. A SID that a backend that allocates IDs has
+// not mapped yet is allocated a uid, but never a uid as well as a gid.
+func ResolveSID(b Backend, sid ntsecurity.SID) (IDType, uint32, error) {
+	if sid.IdentifierAuthority == UnixIdentifierAuthority && len(sid.SubAuthority) == 2 {
+		switch sid.SubAuthority[0] {
+		case unixUserRID:
+			return UserID, sid.SubAuthority[1], nil
+		case unixGroupRID:
+			return GroupID, sid.SubAuthority[1], nil
+		}
+	}
+	if b == nil {
+		return 0, 0, ErrNotMapped
+	}
+	for _, typ := range []IDType{UserID, GroupID} {
+		if id, ok := mappedID(b, sid, typ); ok && mapsBack(b, sid, id, typ) {
+			return typ, id, nil
+		}
+	}
+	if id, err := b.ID(sid, UserID); err == nil && mapsBack(b, sid, id, UserID) {
+		return UserID, id, nil
+	}
+	return 0, 0, ErrNotMapped
+}
+
+// ResolveSIDAs returns the ID of the given type that a SID stands for. The
+// Unix user or group SID of that type stands for its ID, and other SIDs are
+// mapped by the backend, which may be nil, allocating an ID where the backend
+// does so, as winbind does.
+func ResolveSIDAs(b Backend, sid ntsecurity.SID, typ IDType) (uint32, error) {
+	kind := uint32(unixUserRID)
+	if typ == GroupID {
+		kind = unixGroupRID
+	}
+	if sid.IdentifierAuthority == UnixIdentifierAuthority && len(sid.SubAuthority) == 2 && sid.SubAuthority[0] == kind {
+		return sid.SubAuthority[1], nil
+	}
+	if b == nil {
+		return 0, ErrNotMapped
+	}
+	return b.ID(sid, typ)
+}
+
+// allocator is implemented by the backends that allocate IDs for SIDs that
+// they have not mapped yet.
+type allocator interface {
+	// mapped returns the ID of the given type that the SID has been mapped
+	// to, without allocating one.
+	mapped(sid ntsecurity.SID, typ IDType) (uint32, bool)
+}
+
+// mappedID returns the ID of the given type that the backend already maps the
+// SID to, without allocating one.
+func mappedID(b Backend, sid ntsecurity.SID, typ IDType) (uint32, bool) {
+	switch b := b.(type) {
+	case Chain:
+		for _, c := range b {
+			if id, ok := mappedID(c, sid, typ); ok {
+				return id, true
+			}
+		}
+		return 0, false
+	case allocator:
+		return b.mapped(sid, typ)
+	}
+	id, err := b.ID(sid, typ)
+	return id, err == nil
+}
+
+// mapsBack returns true if the ID maps back to the SID.
+func mapsBack(b Backend, sid ntsecurity.SID, id uint32, typ IDType) bool {
+	back, err := b.SID(id, typ)
+	return err == nil && back.Equal(sid)
+}
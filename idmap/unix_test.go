@@ -0,0 +1,97 @@
+package idmap
+
+import (
+	"testing"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+func TestResolveSIDAllocatesOnce(t *testing.T) {
+	sid := ntsecurity.MustParseSID("S-1-5-21-1004336348-1177238915-682003330-1104")
+	alloc, err := NewAllocator(Range{Low: 10000, High: 19999}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, id, err := ResolveSID(alloc, sid)
+	if err != nil || typ != UserID || id != 10000 {
+		t.Errorf("ResolveSID of an unmapped SID returned %v %d, %v, want uid 10000", typ, id, err)
+	}
+	if _, ok := alloc.mapped(sid, GroupID); ok {
+		t.Errorf("ResolveSID allocated a gid as well as a uid")
+	}
+
+	other := ntsecurity.MustParseSID("S-1-5-21-1004336348-1177238915-682003330-513")
+	gid, err := alloc.ID(other, GroupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, id, err = ResolveSID(alloc, other)
+	if err != nil || typ != GroupID || id != gid {
+		t.Errorf("ResolveSID of an allocated gid returned %v %d, %v, want gid %d", typ, id, err, gid)
+	}
+	if _, ok := alloc.mapped(other, UserID); ok {
+		t.Errorf("ResolveSID allocated a uid for a SID mapped to a gid")
+	}
+
+	autorid, err := NewAutoRID(Range{Low: 100000, High: 999999}, DefaultRangeSize, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ, id, err := ResolveSID(autorid, sid); err != nil || typ != UserID || id != 100000+1104 {
+		t.Errorf("autorid: ResolveSID returned %v %d, %v, want uid %d", typ, id, err, 100000+1104)
+	}
+
+	// An existing mapping is preferred to allocating one from a backend
+	// earlier in the chain
+	other = ntsecurity.MustParseSID("S-1-5-21-1-2-3-1104")
+	chain := Chain{autorid, alloc}
+	uid, err := alloc.ID(other, UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ, id, err := ResolveSID(chain, other); err != nil || typ != UserID || id != uid {
+		t.Errorf("chain: ResolveSID returned %v %d, %v, want uid %d", typ, id, err, uid)
+	}
+	if _, ok := autorid.mapped(other, UserID); ok {
+		t.Errorf("chain: ResolveSID allocated a range for a SID that was already mapped")
+	}
+}
+
+func TestResolveSIDUnix(t *testing.T) {
+	for _, test := range []struct {
+		sid string
+		typ IDType
+		id  uint32
+	}{
+		{"S-1-22-1-1000", UserID, 1000},
+		{"S-1-22-2-100", GroupID, 100},
+	} {
+		typ, id, err := ResolveSID(nil, ntsecurity.MustParseSID(test.sid))
+		if err != nil || typ != test.typ || id != test.id {
+			t.Errorf("ResolveSID(%s) = %v %d, %v, want %v %d", test.sid, typ, id, err, test.typ, test.id)
+		}
+	}
+}
+
+func TestResolveSIDAs(t *testing.T) {
+	domain := ntsecurity.MustParseSID("S-1-5-21-1004336348-1177238915-682003330-1104")
+	rid := &RID{Domain: ntsecurity.MustParseSID("S-1-5-21-1004336348-1177238915-682003330"), Range: Range{Low: 10000, High: 19999}}
+	for _, test := range []struct {
+		b   Backend
+		sid ntsecurity.SID
+		typ IDType
+		id  uint32
+		err error
+	}{
+		{nil, ntsecurity.MustParseSID("S-1-22-1-1000"), UserID, 1000, nil},
+		{rid, ntsecurity.MustParseSID("S-1-22-2-100"), GroupID, 100, nil},
+		{nil, ntsecurity.MustParseSID("S-1-22-2-100"), UserID, 0, ErrNotMapped},
+		{nil, domain, UserID, 0, ErrNotMapped},
+		{rid, domain, UserID, 11104, nil},
+	} {
+		id, err := ResolveSIDAs(test.b, test.sid, test.typ)
+		if id != test.id || err != test.err {
+			t.Errorf("ResolveSIDAs(%s, %v) = %d, %v, want %d, %v", test.sid, test.typ, id, err, test.id, test.err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Package fixture provides the checks that the tests of the codecs share,
+// which compare their encodings with the files in testdata.
+package fixture
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// RoundTrip reads the fixture at path and decodes it with unmarshal, then
+// checks that encoding the result again with marshal reproduces the fixture
+// exactly. It returns false if the fixture could not be decoded, in which case
+// the decoded value must not be examined.
+func RoundTrip(t testing.TB, path string, unmarshal func([]byte) error, marshal func() ([]byte, error)) bool {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = unmarshal(data); err != nil {
+		t.Errorf("%s: %v", path, err)
+		return false
+	}
+	out, err := marshal()
+	if err != nil {
+		t.Errorf("%s: %v", path, err)
+		return true
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("%s: re-encoded as\n%x\nwant\n%x", path, out, data)
+	}
+	return true
+}
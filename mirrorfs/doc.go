@@ -0,0 +1,34 @@
+/*
+Package mirrorfs implements a FUSE file system that mirrors a directory tree,
+passing every request through to the underlying file system. Other packages
+can change how individual requests are answered by wrapping its nodes.
+
+Some requests cannot be passed through because the bazil.org/fuse library does
+not support them. The kernel falls back to its own behavior for each of them:
+
+Byte-range (POSIX) locks and flock locks are not negotiated with the kernel,
+so the kernel enforces them locally. Locks are honored between all processes
+that use the mount, such as the processes of a Samba server, but not against
+processes that access the source tree directly.
+
+Fallocate is answered with ENOSYS, which the kernel reports to callers as
+EOPNOTSUPP.
+
+Lseek is answered with ENOSYS, so the kernel handles seeking itself. SEEK_DATA
+and SEEK_HOLE treat the whole file as data.
+
+Copy_file_range is answered with ENOSYS, so the kernel copies the data
+through the mount with ordinary reads and writes.
+
+Directories are read whole. The library only serves directory reads from the
+entries returned by ReadDirAll, numbering them by their position in that
+list, and answers them with no entries otherwise, so the offsets of the
+underlying directory cannot be passed to the kernel. Each time a directory is
+read from the beginning, every entry is read and held until the directory is
+read from the beginning again or closed.
+
+Creation times are only reported on macOS. FUSE on Linux has no way to carry
+them, so programs that need them, such as Samba, must read them from the
+extended attributes of the source file system.
+*/
+package mirrorfs
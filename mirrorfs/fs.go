@@ -1,21 +1,349 @@
 package mirrorfs
 
 import (
+	"log"
 	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
+	"golang.org/x/sys/unix"
 )
 
-func NewFS(file *os.File) (fs.FS, error) {
-	fi, err := file.Stat()
+const (
+	// DefaultAttrTTL is the duration for which the kernel caches the
+	// attributes of a file unless configured otherwise.
+	DefaultAttrTTL = time.Minute
+
+	// DefaultEntryTTL is the duration for which the kernel caches the result
+	// of looking up a name unless configured otherwise.
+	DefaultEntryTTL = time.Minute
+
+	// DefaultPollInterval is the interval at which a watched file system
+	// checks its files for changes unless configured otherwise.
+	DefaultPollInterval = 10 * time.Second
+)
+
+// NodeWrapper returns the value that presents a node to the kernel, which
+// allows other packages to extend the behavior of a node by embedding it. The
+// wrapper must return equal values when called with the same node, since the
+// server identifies nodes by their value.
+type NodeWrapper func(*Node) fs.Node
+
+// fileID identifies a file in the source tree by its device and inode number.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func statID(fi os.FileInfo) fileID {
+	st := fi.Sys().(*syscall.Stat_t)
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+}
+
+// FS mirrors a directory tree.
+//
+// The file system keeps a table of the nodes that are known to the kernel,
+// keyed by the device and inode number of the underlying file, so that every
+// name for a file is presented as the same node. Nodes refer to their files by
+// path and do not hold file descriptors; descriptors are only held by the
+// handles of open files and directories.
+//
+// Every path is resolved relative to a descriptor for the root directory, and
+// no symbolic link within the tree is ever followed, so no request can reach
+// a file outside of the tree.
+type FS struct {
+	// Links controls how symbolic links that leave the tree are presented.
+	// It must not be changed once the file system is being served.
+	Links LinkPolicy
+
+	// AttrTTL is the duration for which the kernel may cache the attributes
+	// of a file, and EntryTTL the duration for which it may cache the result
+	// of looking up a name. Changes that are made to the source tree other
+	// than through the file system may go unnoticed for that long. Entries
+	// created by Mkdir, Mknod, Symlink and Link are always cached for
+	// DefaultEntryTTL, since the library does not allow it to be changed.
+	AttrTTL  time.Duration
+	EntryTTL time.Duration
+
+	// PollInterval is the interval at which Watch checks the files known to
+	// the kernel for changes that inotify does not report. Polling is
+	// disabled if it is not positive.
+	PollInterval time.Duration
+
+	wrap     NodeWrapper
+	root     *Node
+	rootFile *os.File
+	watcher  *watcher // Set if changes to the source tree are watched
+
+	serverMu sync.Mutex // Protects the server, which the watcher uses concurrently
+	server   *fs.Server // Set once the file system is being served
+
+	mu    sync.Mutex // Protects the table and the location of every node
+	nodes map[fileID]*Node
+}
+
+// New returns a file system that mirrors the directory at the given path.
+// When wrap is nil the nodes are presented as they are.
+func New(path string, wrap NodeWrapper) (*FS, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := openRoot(path)
+	if err != nil {
+		// It no longer exists, is not accessible or is not a directory
+		return nil, err
+	}
+	fi, err := root.Stat()
+	if err != nil {
+		root.Close()
+		return nil, err
+	}
+	if wrap == nil {
+		wrap = func(n *Node) fs.Node { return n }
+	}
+	f := &FS{
+		AttrTTL:      DefaultAttrTTL,
+		EntryTTL:     DefaultEntryTTL,
+		PollInterval: DefaultPollInterval,
+		wrap:         wrap,
+		rootFile:     root,
+		nodes:        make(map[fileID]*Node),
+	}
+	f.root = f.node(nil, path, fi)
+	return f, nil
+}
+
+// Close releases the descriptor for the root directory. The file system must
+// no longer be served.
+func (f *FS) Close() error {
+	if f.watcher != nil {
+		f.watcher.close()
+	}
+	return f.rootFile.Close()
+}
+
+var _ fs.FS = (*FS)(nil)
+
+func (f *FS) Root() (fs.Node, error) {
+	return f.wrap(f.root), nil
+}
+
+// node returns the node for the file described by fi, which was found with
+// the given name in dir. A node is added to the table if the file is not
+// already known. Otherwise the existing node is moved to the name it was most
+// recently found under.
+func (f *FS) node(dir *Node, name string, fi os.FileInfo) *Node {
+	id := statID(fi)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.nodes[id]
+	if !ok || n.mode != fi.Mode()&os.ModeType {
+		// A file that differs in type cannot be the same file, so the inode
+		// number must have been reused
+		n = &Node{
+			fs:   f,
+			id:   id,
+			mode: fi.Mode() & os.ModeType,
+		}
+		f.nodes[id] = n
+	}
+	if n.parent != nil && (n.parent != dir || n.name != name) && n.mode&os.ModeDir == 0 {
+		n.dropLink(dir, name)
+		n.links = append(n.links, entry{n.parent, n.name})
+	}
+	n.parent, n.name = dir, name
+	return n
+}
+
+// dropLink removes the name from the other names of the node.
+func (n *Node) dropLink(dir *Node, name string) {
+	for i, e := range n.links {
+		if e.dir == dir && e.name == name {
+			n.links = append(n.links[:i], n.links[i+1:]...)
+			return
+		}
+	}
+}
+
+// moved updates the location of the node for the file described by fi, if
+// there is one, after it has been renamed from the name in one directory to
+// the name in another. A file with several links stays where it is if it was
+// renamed through one of its other names.
+func (f *FS) moved(fi os.FileInfo, fromDir *Node, from string, dir *Node, name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.nodes[statID(fi)]
+	if !ok {
+		return
+	}
+	if n.parent != nil && (n.parent != fromDir || n.name != from) && n.mode&os.ModeDir == 0 {
+		n.dropLink(fromDir, from)
+		n.links = append(n.links, entry{dir, name})
+		return
+	}
+	n.parent, n.name = dir, name
+}
+
+// unlinked detaches the node for the file described by fi, if it is located
+// at the given name in dir, after that name has been removed. The node is
+// dropped from the table when it was the last link to the file so that a
+// reused inode number will be given a new node.
+//
+// A file that still has other links is moved to one of them, so that it
+// remains reachable through the names that the kernel still knows it by. The
+// links are those the node has been found under, and otherwise the entries of
+// dir. A file whose remaining links are in other directories and have not
+// been looked up stays detached until one of them is.
+func (f *FS) unlinked(fi os.FileInfo, dir *Node, name string) {
+	id := statID(fi)
+	f.mu.Lock()
+	n, ok := f.nodes[id]
+	if !ok {
+		f.mu.Unlock()
+		return
+	}
+	n.dropLink(dir, name)
+	if n.parent != dir || n.name != name {
+		f.mu.Unlock()
+		return
+	}
+	n.parent, n.name = nil, ""
+	if fi.IsDir() || fi.Sys().(*syscall.Stat_t).Nlink <= 1 {
+		delete(f.nodes, id)
+		f.mu.Unlock()
+		return
+	}
+	links := n.links
+	n.links = nil
+	f.mu.Unlock()
+
+	// Finding the surviving link needs the locations of the directories, so
+	// the lock cannot be held while they are examined
+	link, links, ok := f.survivingLink(id, dir, links)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n.parent == nil {
+		n.parent, n.name = link.dir, link.name
+		n.links = append(n.links, links...)
+	}
+}
+
+// survivingLink returns a name of the file with the given ID among the links,
+// or else among the entries of dir, and the links that remain to be tried.
+func (f *FS) survivingLink(id fileID, dir *Node, links []entry) (entry, []entry, bool) {
+	for i, e := range links {
+		if f.linksTo(e, id) {
+			return e, links[i+1:], true
+		}
+	}
+	d, err := dir.open(unix.O_RDONLY | unix.O_DIRECTORY)
 	if err != nil {
-		// It no longer exists or is not accessible for some reason
-		return Node{}, err // FIXME: Correct error response?
+		return entry{}, nil, false
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return entry{}, nil, false
+	}
+	for _, name := range names {
+		if fi, err := statAt(d, name); err == nil && statID(fi) == id {
+			return entry{dir, name}, nil, true
+		}
+	}
+	return entry{}, nil, false
+}
+
+// linksTo returns true if the entry names the file with the given ID.
+func (f *FS) linksTo(e entry, id fileID) bool {
+	d, err := e.dir.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return false
+	}
+	defer d.Close()
+	fi, err := statAt(d, e.name)
+	return err == nil && statID(fi) == id
+}
+
+// forget drops the node from the table once the kernel no longer refers to it.
+func (f *FS) forget(n *Node) {
+	f.unwatch(n)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.nodes[n.id] == n {
+		delete(f.nodes, n.id)
 	}
-	if !fi.IsDir() {
-		// Not a directory
-		return Node{}, fuse.ENOENT // FIXME: Correct error response?
+}
+
+// setServer records the server that serves the file system.
+func (f *FS) setServer(server *fs.Server) {
+	f.serverMu.Lock()
+	defer f.serverMu.Unlock()
+	f.server = server
+}
+
+// getServer returns the server that serves the file system, or nil if it is
+// not being served yet.
+func (f *FS) getServer() *fs.Server {
+	f.serverMu.Lock()
+	defer f.serverMu.Unlock()
+	return f.server
+}
+
+// invalidateAttr discards the attributes of the node cached by the kernel,
+// after they were changed in a way that the kernel cannot anticipate.
+func (f *FS) invalidateAttr(n *Node) {
+	if server := f.getServer(); server != nil {
+		f.invalidated(n, server.InvalidateNodeAttr(f.wrap(n)))
+	}
+}
+
+// invalidateData discards the attributes and data of the node cached by the
+// kernel.
+func (f *FS) invalidateData(n *Node) {
+	if server := f.getServer(); server != nil {
+		f.invalidated(n, server.InvalidateNodeData(f.wrap(n)))
+	}
+}
+
+// invalidateEntry discards the result of looking up the name in the directory
+// cached by the kernel.
+func (f *FS) invalidateEntry(dir *Node, name string) {
+	if server := f.getServer(); server != nil {
+		f.invalidated(dir, server.InvalidateEntry(f.wrap(dir), name))
+	}
+}
+
+// invalidateAll discards everything that the kernel has cached about every
+// node.
+func (f *FS) invalidateAll() {
+	f.mu.Lock()
+	var entries []entry
+	nodes := make([]*Node, 0, len(f.nodes))
+	for _, n := range f.nodes {
+		nodes = append(nodes, n)
+		if n.parent != nil {
+			entries = append(entries, entry{n.parent, n.name})
+		}
+	}
+	f.mu.Unlock()
+	for _, e := range entries {
+		f.invalidateEntry(e.dir, e.name)
+	}
+	for _, n := range nodes {
+		f.invalidateData(n)
+	}
+}
+
+func (f *FS) invalidated(n *Node, err error) {
+	if err != nil && err != fuse.ErrNotCached {
+		log.Printf("%s INVALIDATE: %s: %v", n.Kind(), n.Path(), err)
 	}
-	return Node{file}, nil
 }
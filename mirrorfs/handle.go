@@ -0,0 +1,134 @@
+package mirrorfs
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/net/context"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// Handle is an open file or directory in the source tree. Each handle owns a
+// file descriptor that was opened with the access mode requested by the
+// caller.
+//
+// Handles are reference counted so that the descriptor is only closed once
+// the handle has been released and every request that is using it has
+// completed.
+type Handle struct {
+	node *Node
+	file *os.File
+	refs int32
+	mu   sync.Mutex // Serializes directory reads, which depend on the file offset
+}
+
+func newHandle(node *Node, file *os.File) *Handle {
+	return &Handle{node: node, file: file, refs: 1}
+}
+
+// acquire adds a reference to the handle. It returns false if the handle has
+// already been closed.
+func (h *Handle) acquire() bool {
+	for {
+		refs := atomic.LoadInt32(&h.refs)
+		if refs <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&h.refs, refs, refs+1) {
+			return true
+		}
+	}
+}
+
+// release removes a reference from the handle and closes its descriptor when
+// no references remain.
+func (h *Handle) release() error {
+	if atomic.AddInt32(&h.refs, -1) == 0 {
+		return h.file.Close()
+	}
+	return nil
+}
+
+var _ = fs.HandleReader(&Handle{})
+
+func (h *Handle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	log.Printf("HANDLE READ: %s %v", h.node.Path(), req)
+	if !h.acquire() {
+		return fuse.Errno(syscall.EBADF)
+	}
+	defer h.release()
+	data := resp.Data[:req.Size] // Bazil allocates the data with a capacity of req.Size but initializes its length to 0
+	n, err := h.file.ReadAt(data, req.Offset)
+	resp.Data = data[:n]
+	if err == io.EOF {
+		return nil
+	}
+	return errorOSToFuse(err)
+}
+
+var _ = fs.HandleWriter(&Handle{})
+
+func (h *Handle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	log.Printf("HANDLE WRITE: %s %v", h.node.Path(), req)
+	if !h.acquire() {
+		return fuse.Errno(syscall.EBADF)
+	}
+	defer h.release()
+	defer h.node.fs.changing(h.node, h.file)()
+	n, err := h.file.WriteAt(req.Data, req.Offset)
+	resp.Size = n
+	return errorOSToFuse(err)
+}
+
+var _ = fs.HandleReadDirAller(&Handle{})
+
+// ReadDirAll returns the entries of an open directory. The server encodes the
+// entries once and serves the kernel's reads of the directory from them,
+// calling ReadDirAll again whenever the directory is read from the beginning.
+// The library offers no way to serve those reads from the offsets of the
+// underlying directory instead, so large directories are read whole; see the
+// package documentation.
+func (h *Handle) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	log.Printf("HANDLE READDIR: %s", h.node.Path())
+	if !h.acquire() {
+		return nil, fuse.Errno(syscall.EBADF)
+	}
+	defer h.release()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entries, err := readDir(h.file, h.node.Path())
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	if h.node.fs.Links != LinksShow {
+		visible := entries[:0]
+		for _, e := range entries {
+			if e.Type != fuse.DT_Link || !h.node.hiddenLink(h.file, e.Name) {
+				visible = append(visible, e)
+			}
+		}
+		entries = visible
+	}
+	return entries, nil
+}
+
+var _ = fs.HandleFlusher(&Handle{})
+
+func (h *Handle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	log.Printf("HANDLE FLUSH: %s %v", h.node.Path(), req)
+	// Writes are passed through as they arrive, so there is nothing to flush
+	return nil
+}
+
+var _ = fs.HandleReleaser(&Handle{})
+
+func (h *Handle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	log.Printf("HANDLE RELEASE: %s %v", h.node.Path(), req)
+	return errorOSToFuse(h.release())
+}
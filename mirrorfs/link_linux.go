@@ -0,0 +1,105 @@
+package mirrorfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"go.scj.io/samba-over-ntfs/ntfs"
+)
+
+// ErrUnsupportedReparsePoint is returned when a reparse point cannot be
+// presented as a symbolic link.
+var ErrUnsupportedReparsePoint = errors.New("Unsupported reparse point")
+
+// readLink returns the target of the symbolic link opened as f with O_PATH.
+//
+// When the link is an NTFS reparse point its target is derived from the
+// reparse data, so that targets expressed as Windows paths are translated
+// into paths relative to the link. Otherwise the target reported by the
+// underlying file system is returned.
+func readLink(f *os.File) (string, error) {
+	data, err := getxattrAll(procPath(f), ntfs.ReparseDataName)
+	if err != nil {
+		// Not a reparse point or not an ntfs-3g file system
+		return readlinkFile(f)
+	}
+	var rp ntfs.ReparsePoint
+	if err = rp.UnmarshalBinary(data); err != nil {
+		return "", err
+	}
+	switch rp.Tag {
+	case ntfs.ReparseTagSymlink, ntfs.ReparseTagMountPoint:
+		return reparseTarget(f.Name(), &rp)
+	case ntfs.ReparseTagLXSymlink:
+		return rp.SubstituteName, nil
+	default:
+		return "", ErrUnsupportedReparsePoint
+	}
+}
+
+// readlinkFile returns the target of the symbolic link opened as f with
+// O_PATH, as reported by the underlying file system.
+func readlinkFile(f *os.File) (string, error) {
+	for size := 256; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := unix.Readlinkat(int(f.Fd()), "", buf)
+		if err != nil {
+			return "", &os.PathError{Op: "readlink", Path: f.Name(), Err: err}
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
+
+// reparseTarget translates the target of a symbolic link or mount point
+// reparse point into a path relative to the directory containing the link.
+//
+// Drive letters cannot be mapped to mounted file systems, so absolute targets
+// are assumed to be located on the same volume as the link, which is also the
+// assumption made by ntfs-3g.
+func reparseTarget(path string, rp *ntfs.ReparsePoint) (string, error) {
+	target := rp.SubstituteName
+	if rp.Tag == ntfs.ReparseTagSymlink && rp.Flags.HasFlag(ntfs.SymlinkRelative) {
+		return strings.Replace(target, `\`, "/", -1), nil
+	}
+
+	for _, prefix := range []string{`\??\`, `\\?\`} {
+		target = strings.TrimPrefix(target, prefix)
+	}
+	if len(target) < 2 || target[1] != ':' {
+		// Volume GUID and UNC paths have no local equivalent
+		return "", ErrUnsupportedReparsePoint
+	}
+	target = strings.Replace(target[2:], `\`, "/", -1)
+
+	dir := filepath.Dir(path)
+	root, err := volumeRoot(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(dir, filepath.Join(root, target))
+}
+
+// volumeRoot returns the mount point of the file system containing the given
+// absolute path.
+func volumeRoot(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+	for path != "/" {
+		parent := filepath.Dir(path)
+		var pst syscall.Stat_t
+		if err := syscall.Stat(parent, &pst); err != nil || pst.Dev != st.Dev {
+			break
+		}
+		path = parent
+	}
+	return path, nil
+}
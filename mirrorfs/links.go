@@ -0,0 +1,108 @@
+package mirrorfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LinkPolicy controls how symbolic links whose targets lie outside of the
+// mirrored tree are presented. Targets are examined lexically, so a target
+// that only leaves the tree through another link is not detected.
+//
+// Absolute targets are always considered to lie outside of the tree, since
+// they are resolved by the caller outside of the mount.
+type LinkPolicy int
+
+const (
+	// LinksShow presents every link with its target unchanged.
+	LinksShow LinkPolicy = iota
+
+	// LinksHide hides links whose targets lie outside of the tree.
+	LinksHide
+
+	// LinksRewrite rewrites absolute targets within the source tree as
+	// relative targets, so that they resolve within the mount, and hides
+	// links whose targets lie outside of the tree.
+	LinksRewrite
+)
+
+var errInvalidLinkPolicy = errors.New("Link policy must be one of: show, hide, rewrite")
+
+func (p LinkPolicy) String() string {
+	switch p {
+	case LinksShow:
+		return "show"
+	case LinksHide:
+		return "hide"
+	case LinksRewrite:
+		return "rewrite"
+	default:
+		return "unknown"
+	}
+}
+
+// Set parses the name of a link policy, which allows a policy to be used as a
+// command line flag.
+func (p *LinkPolicy) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "show":
+		*p = LinksShow
+	case "hide":
+		*p = LinksHide
+	case "rewrite":
+		*p = LinksRewrite
+	default:
+		return errInvalidLinkPolicy
+	}
+	return nil
+}
+
+// presentLink returns the target to present for the symbolic link at the
+// given path relative to the root of the tree, or false if the link should
+// be hidden.
+func (f *FS) presentLink(rel string, target string) (string, bool) {
+	if f.Links == LinksShow {
+		return target, true
+	}
+	if !filepath.IsAbs(target) {
+		resolved := filepath.Join(filepath.Dir(rel), target)
+		if resolved == ".." || strings.HasPrefix(resolved, "../") {
+			return "", false
+		}
+		return target, true
+	}
+	root := f.root.name
+	if f.Links == LinksRewrite && (target == root || strings.HasPrefix(target, root+"/")) {
+		if r, err := filepath.Rel(filepath.Join(root, filepath.Dir(rel)), target); err == nil {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+// hiddenLink returns true if the named entry of the directory opened as dir
+// is a symbolic link that the link policy hides.
+func (d *Node) hiddenLink(dir *os.File, name string) bool {
+	if d.fs.Links == LinksShow {
+		return false
+	}
+	f, err := openEntry(dir, name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	target, err := readLink(f)
+	if err != nil {
+		return false // Unsupported links are reported when they are read
+	}
+	d.fs.mu.Lock()
+	rel, ok := d.relPath()
+	d.fs.mu.Unlock()
+	if !ok {
+		return false
+	}
+	_, visible := d.fs.presentLink(filepath.Join(rel, name), target)
+	return !visible
+}
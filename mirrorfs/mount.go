@@ -1,35 +1,36 @@
 package mirrorfs
 
 import (
-	"os"
 	"path/filepath"
+	"syscall"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 )
 
-type NodeCreator func(*os.File) (fs.FS, error)
-
-func Mount(path, mountpoint string, fsName string, subtype string, volumeName string, creator NodeCreator) error {
-	path, err := filepath.Abs(path)
+// Mount mirrors the directory at path onto mountpoint and serves it until the
+// file system is unmounted. The nodes are presented through wrap, which may be
+// nil.
+func Mount(path, mountpoint string, fsName string, subtype string, volumeName string, wrap NodeWrapper) error {
+	root, err := New(path, wrap)
 	if err != nil {
 		return err
 	}
-	mountpoint, err = filepath.Abs(mountpoint)
+	defer root.Close()
+	return Serve(root, mountpoint, fsName, subtype, volumeName)
+}
+
+// Serve mounts the file system onto mountpoint and serves it until the file
+// system is unmounted.
+func Serve(root *FS, mountpoint string, fsName string, subtype string, volumeName string) error {
+	mountpoint, err := filepath.Abs(mountpoint)
 	if err != nil {
 		return err
 	}
-	path = filepath.Clean(path)
 	mountpoint = filepath.Clean(mountpoint)
-	file, err := os.Open(path)
-	if err != nil {
-		return err
-	}
 
-	root, err := creator(file)
-	if err != nil {
-		return err // FIXME: Correct error response?
-	}
+	// Requests carry modes that have already had the caller's umask applied
+	syscall.Umask(0)
 
 	c, err := fuse.Mount(
 		mountpoint,
@@ -45,7 +46,9 @@ func Mount(path, mountpoint string, fsName string, subtype string, volumeName st
 	defer fuse.Unmount(mountpoint)
 	defer c.Close()
 
-	err = fs.Serve(c, root)
+	server := fs.New(c, nil)
+	root.setServer(server)
+	err = server.Serve(root)
 	if err != nil {
 		return err
 	}
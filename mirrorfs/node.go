@@ -1,157 +1,516 @@
 package mirrorfs
 
 import (
-	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 )
 
+// Node is a file in the source tree. A node refers to its file by the name it
+// was found under and the node of the directory containing it, so it follows
+// the file when it is renamed through the file system.
 type Node struct {
-	*os.File
+	fs   *FS
+	id   fileID
+	mode os.FileMode // The type bits of the file, which never change
+
+	// The location of the node, which is protected by the mutex of the file
+	// system. The root node has no parent and is named by its absolute path.
+	// A node that has been removed has neither.
+	parent *Node
+	name   string
+
+	// Other names that a file with several links has been found under, which
+	// the node is moved to when its current name is removed. They are only
+	// checked when they are needed, so some may no longer exist.
+	links []entry
 }
 
-func NewNode(file *os.File) (Node, error) {
-	_, err := file.Stat()
-	if err != nil {
-		return Node{}, fuse.ENOENT // FIXME: Correct error response?
-	}
-	return Node{file}, nil
+// self returns the node, including when it is embedded by a wrapper.
+func (n *Node) self() *Node {
+	return n
 }
 
-func (n Node) IsDir() bool {
-	if fi, _ := n.File.Stat(); fi.IsDir() {
-		return true
-	}
-	return false
+// Path returns the current path of the node within the source tree, which
+// follows the node if it is renamed.
+func (n *Node) Path() string {
+	n.fs.mu.Lock()
+	defer n.fs.mu.Unlock()
+	return n.path()
 }
 
-func (n Node) Kind() string {
-	if n.File == nil {
-		return "NIL"
+func (n *Node) path() string {
+	if n.parent == nil {
+		return n.name
 	}
-	if n.IsDir() {
-		return "DIR"
+	return filepath.Join(n.parent.path(), n.name)
+}
+
+// relPath returns the path of the node relative to the root of the file
+// system. It returns false if the node has been removed.
+func (n *Node) relPath() (string, bool) {
+	switch {
+	case n == n.fs.root:
+		return ".", true
+	case n.parent == nil:
+		return "", false
+	case n.parent == n.fs.root:
+		return n.name, true
 	}
-	return "FILE"
+	dir, ok := n.parent.relPath()
+	return dir + "/" + n.name, ok
 }
 
-// FS Methods
+// validName returns an error unless the name refers to an entry within a
+// directory. The kernel only sends such names, so this is a safeguard that
+// keeps every path beneath the root of the file system.
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, '/') {
+		return fuse.Errno(syscall.EINVAL)
+	}
+	return nil
+}
 
-var _ fs.FS = (*Node)(nil)
+func (n *Node) IsDir() bool {
+	return n.mode.IsDir()
+}
 
-func (f Node) Root() (fs.Node, error) {
-	return f, nil
+func (n *Node) Kind() string {
+	switch {
+	case n == nil:
+		return "NIL"
+	case n.mode&os.ModeDir != 0:
+		return "DIR"
+	case n.mode&os.ModeSymlink != 0:
+		return "LINK"
+	default:
+		return "FILE"
+	}
 }
 
 // Node Methods
 
 var _ fs.Node = (*Node)(nil)
 
-func (n Node) Attr(ctx context.Context, a *fuse.Attr) error {
-	log.Printf("%s ATTR: %s", n.Kind(), n.Name())
-	attrOSToFuse(n.File, a)
+func (n *Node) Attr(ctx context.Context, a *fuse.Attr) error {
+	log.Printf("%s ATTR: %s", n.Kind(), n.Path())
+	f, err := n.open(unix.O_PATH)
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	n.fs.revalidate(n, fi)
+	attrOSToFuse(fi, a)
+	a.Valid = n.fs.AttrTTL
+	if fi.Mode()&os.ModeSymlink != 0 {
+		// The size of a link is the length of its target, which may have been
+		// translated or rewritten
+		if target, err := n.readLink(f); err == nil {
+			a.Size = uint64(len(target))
+		}
+	}
 	return nil
 }
 
+// Stat returns information about the file of the node.
+func (n *Node) Stat() (os.FileInfo, error) {
+	f, err := n.open(unix.O_PATH)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	return fi, nil
+}
+
 var _ = fs.NodeForgetter(&Node{})
 
-func (n Node) Forget() {
-	log.Printf("%s FORGET: %s", n.Kind(), n.Name())
-	n.Close()
+func (n *Node) Forget() {
+	log.Printf("%s FORGET: %s", n.Kind(), n.Path())
+	n.fs.forget(n)
+}
+
+var _ = fs.NodeSetattrer(&Node{})
+
+func (n *Node) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	log.Printf("%s SETATTR: %s %v", n.Kind(), n.Path(), req)
+	f, err := n.open(unix.O_PATH)
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	defer f.Close()
+	defer n.fs.changing(n, f)()
+	if err := setAttr(procPath(f), req); err != nil {
+		return errorOSToFuse(err)
+	}
+	// The server fills in the attributes of the response by calling Attr
+	return nil
+}
+
+var _ = fs.NodeFsyncer(&Node{})
+
+func (n *Node) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	log.Printf("%s FSYNC: %s %v", n.Kind(), n.Path(), req)
+	// Synchronizing any descriptor for the file flushes all of its data
+	f, err := n.open(os.O_RDONLY)
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	defer f.Close()
+	return errorOSToFuse(f.Sync())
 }
 
 var _ = fs.NodeGetxattrer(&Node{})
 
-func (n Node) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) (err error) {
-	log.Printf("%s GETXATTR: %s %v", n.Kind(), n.Name(), req)
-	resp.Xattr, err = GetFileXAttr(n.File, req.Name, req.Size, req.Position)
+func (n *Node) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) (err error) {
+	log.Printf("%s GETXATTR: %s %v", n.Kind(), n.Path(), req)
+	resp.Xattr, err = n.GetXAttr(req.Name, req.Size, req.Position)
 	return
 }
 
 var _ = fs.NodeListxattrer(&Node{})
 
-func (n Node) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) (err error) {
-	log.Printf("%s LISTXATTR: %s %v", n.Kind(), n.Name(), req)
-	resp.Xattr, err = ListFileXAttr(n.File, req.Size, req.Position)
+func (n *Node) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) (err error) {
+	log.Printf("%s LISTXATTR: %s %v", n.Kind(), n.Path(), req)
+	resp.Xattr, err = n.ListXAttr(req.Size, req.Position)
 	return
 }
 
-/*
-var _ = fs.NodeSetxattrer(&File{})
+var _ = fs.NodeSetxattrer(&Node{})
 
-func (f File) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) (err error) {
-	log.Printf("FILE SETXATTR: %s %v", f.Name(), req)
-	return nil
+func (n *Node) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) (err error) {
+	log.Printf("%s SETXATTR: %s %v", n.Kind(), n.Path(), req)
+	return n.SetXAttr(req.Name, req.Xattr, req.Flags, req.Position)
 }
 
-var _ = fs.NodeRemovexattrer(&File{})
+var _ = fs.NodeRemovexattrer(&Node{})
 
-func (f File) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) (err error) {
-	log.Printf("FILE REMOVEXATTR: %s %v", f.Name(), req)
-	return nil
+func (n *Node) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) (err error) {
+	log.Printf("%s REMOVEXATTR: %s %v", n.Kind(), n.Path(), req)
+	return n.RemoveXAttr(req.Name)
+}
+
+// Link methods
+
+var _ = fs.NodeReadlinker(&Node{})
+
+func (n *Node) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	log.Printf("%s READLINK: %s", n.Kind(), n.Path())
+	f, err := n.open(unix.O_PATH)
+	if err != nil {
+		return "", errorOSToFuse(err)
+	}
+	defer f.Close()
+	target, err := n.readLink(f)
+	if err == ErrUnsupportedReparsePoint {
+		log.Printf("%s READLINK: %s: %v", n.Kind(), n.Path(), err)
+		return "", fuse.ENOTSUP
+	}
+	if err != nil {
+		return "", errorOSToFuse(err)
+	}
+	return target, nil
+}
+
+// readLink returns the target to present for the symbolic link opened as f.
+func (n *Node) readLink(f *os.File) (string, error) {
+	target, err := readLink(f)
+	if err != nil {
+		return "", err
+	}
+	n.fs.mu.Lock()
+	rel, _ := n.relPath()
+	n.fs.mu.Unlock()
+	target, ok := n.fs.presentLink(rel, target)
+	if !ok {
+		// The link was hidden after the kernel looked it up
+		return "", syscall.ENOENT
+	}
+	return target, nil
+}
+
+var _ = fs.NodeSymlinker(&Node{})
+
+func (d *Node) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, error) {
+	log.Printf("%s SYMLINK: %s : %s -> %s", d.Kind(), req.NewName, d.Path(), req.Target)
+	if err := validName(req.NewName); err != nil {
+		return nil, err
+	}
+	dir, err := d.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	defer dir.Close()
+	defer d.fs.changing(d, dir)()
+	if err := unix.Symlinkat(req.Target, int(dir.Fd()), req.NewName); err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	setOwner(dir, req.NewName, &req.Header)
+	node, err := d.child(dir, req.NewName)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	return d.fs.wrap(node), nil
+}
+
+var _ = fs.NodeLinker(&Node{})
+
+func (d *Node) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.Node, error) {
+	target, ok := old.(interface {
+		self() *Node
+	})
+	if !ok {
+		return nil, fuse.EIO
+	}
+	n := target.self()
+	log.Printf("%s LINK: %s : %s -> %s", d.Kind(), req.NewName, d.Path(), n.Path())
+	if err := validName(req.NewName); err != nil {
+		return nil, err
+	}
+	dir, err := d.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	defer dir.Close()
+	f, err := n.open(unix.O_PATH)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	defer f.Close()
+	defer d.fs.changing(d, dir)()
+	defer n.fs.changing(n, f)()
+	// Linking the descriptor through its path in /proc does not require the
+	// capabilities that linking it directly with AT_EMPTY_PATH does
+	if err := unix.Linkat(unix.AT_FDCWD, procPath(f), int(dir.Fd()), req.NewName, unix.AT_SYMLINK_FOLLOW); err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	node, err := d.child(dir, req.NewName)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	return d.fs.wrap(node), nil
 }
-*/
 
 // Directory methods
 
+// child returns the node for the named entry of the directory opened as dir.
+func (d *Node) child(dir *os.File, name string) (*Node, error) {
+	fi, err := statAt(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	node := d.fs.node(d, name, fi)
+	d.fs.watchDir(node)
+	return node, nil
+}
+
 var _ = fs.NodeRequestLookuper(&Node{})
 
-func (d Node) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
-	//fi, err := file.Stat()
-	path := filepath.Join(d.Name(), req.Name)
-	log.Printf("%s LOOKUP: %s : %s", d.Kind(), req.Name, path)
-	file, err := os.Open(path)
+func (d *Node) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
+	log.Printf("%s LOOKUP: %s : %s", d.Kind(), req.Name, d.Path())
+	if err := validName(req.Name); err != nil {
+		return nil, err
+	}
+	dir, err := d.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	defer dir.Close()
+	fi, err := statAt(dir, req.Name)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	if fi.Mode()&os.ModeSymlink != 0 && d.hiddenLink(dir, req.Name) {
+		return nil, fuse.ENOENT
+	}
+	node := d.fs.node(d, req.Name, fi)
+	d.fs.watchDir(node)
+	resp.EntryValid = d.fs.EntryTTL
+	return d.fs.wrap(node), nil
+}
+
+var _ = fs.NodeCreater(&Node{})
+
+func (d *Node) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	log.Printf("%s CREATE: %s : %s", d.Kind(), req.Name, d.Path())
+	if err := validName(req.Name); err != nil {
+		return nil, nil, err
+	}
+	dir, err := d.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return nil, nil, errorOSToFuse(err)
+	}
+	defer dir.Close()
+	defer d.fs.changing(d, dir)()
+	flags := openFlags(req.Flags) | os.O_CREATE | unix.O_NOFOLLOW | unix.O_CLOEXEC
+	if req.Flags&fuse.OpenFlags(os.O_EXCL) != 0 {
+		flags |= os.O_EXCL
+	}
+	fd, err := unix.Openat(int(dir.Fd()), req.Name, flags, modeOSToUnix(req.Mode&^req.Umask)&^unix.S_IFMT)
+	if err != nil {
+		return nil, nil, errorOSToFuse(err)
+	}
+	file := os.NewFile(uintptr(fd), filepath.Join(dir.Name(), req.Name))
+	setOwner(dir, req.Name, &req.Header)
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, errorOSToFuse(err)
+	}
+	node := d.fs.node(d, req.Name, fi)
+	resp.EntryValid = d.fs.EntryTTL
+	return d.fs.wrap(node), newHandle(node, file), nil
+}
+
+var _ = fs.NodeMkdirer(&Node{})
+
+func (d *Node) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	log.Printf("%s MKDIR: %s : %s", d.Kind(), req.Name, d.Path())
+	if err := validName(req.Name); err != nil {
+		return nil, err
+	}
+	dir, err := d.open(unix.O_PATH | unix.O_DIRECTORY)
 	if err != nil {
-		return nil, fuse.ENOENT // FIXME: Correct error response?
+		return nil, errorOSToFuse(err)
+	}
+	defer dir.Close()
+	defer d.fs.changing(d, dir)()
+	if err := unix.Mkdirat(int(dir.Fd()), req.Name, modeOSToUnix(req.Mode&^req.Umask)&^unix.S_IFMT); err != nil {
+		return nil, errorOSToFuse(err)
 	}
-	return NewNode(file)
+	setOwner(dir, req.Name, &req.Header)
+	node, err := d.child(dir, req.Name)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	return d.fs.wrap(node), nil
 }
 
-var _ = fs.HandleReadDirAller(&Node{})
+var _ = fs.NodeMknoder(&Node{})
 
-func (d Node) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
-	log.Printf("%s READDIR: %s", d.Kind(), d.Name())
-	var out []fuse.Dirent
-	// Self
-	self, err := d.File.Stat()
-	if err == nil {
-		out = append(out, direntOSToFuse(self, "."))
+func (d *Node) Mknod(ctx context.Context, req *fuse.MknodRequest) (fs.Node, error) {
+	log.Printf("%s MKNOD: %s : %s", d.Kind(), req.Name, d.Path())
+	if err := validName(req.Name); err != nil {
+		return nil, err
 	}
-	// Parent
-	parent, err := os.Stat(filepath.Join(d.Name(), ".."))
-	if err == nil {
-		out = append(out, direntOSToFuse(parent, ".."))
+	dir, err := d.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return nil, errorOSToFuse(err)
 	}
-	// Children
-	// FIXME: Stream the dirents instead of slurping them
-	entries, err := d.Readdir(0)
+	defer dir.Close()
+	defer d.fs.changing(d, dir)()
+	if err := unix.Mknodat(int(dir.Fd()), req.Name, modeOSToUnix(req.Mode&^req.Umask), int(req.Rdev)); err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	setOwner(dir, req.Name, &req.Header)
+	node, err := d.child(dir, req.Name)
 	if err != nil {
-		return nil, fuse.ENOENT // FIXME: Correct error response?
+		return nil, errorOSToFuse(err)
 	}
-	for _, fi := range entries {
-		out = append(out, direntOSToFuse(fi, fi.Name()))
+	return d.fs.wrap(node), nil
+}
+
+var _ = fs.NodeRemover(&Node{})
+
+func (d *Node) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	log.Printf("%s REMOVE: %s : %s", d.Kind(), req.Name, d.Path())
+	if err := validName(req.Name); err != nil {
+		return err
 	}
-	d.Seek(0, 0) // Reset the position so that subsequent calls will start at the beginning
-	return out, nil
+	dir, err := d.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	defer dir.Close()
+	fi, err := statAt(dir, req.Name)
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	defer d.fs.changing(d, dir)()
+	flags := 0
+	if req.Dir {
+		flags = unix.AT_REMOVEDIR
+	}
+	if err := unix.Unlinkat(int(dir.Fd()), req.Name, flags); err != nil {
+		return errorOSToFuse(err)
+	}
+	d.fs.unlinked(fi, d, req.Name)
+	return nil
+}
+
+var _ = fs.NodeRenamer(&Node{})
+
+func (d *Node) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	dest, ok := newDir.(interface {
+		self() *Node
+	})
+	if !ok {
+		return fuse.EIO
+	}
+	to := dest.self()
+	log.Printf("%s RENAME: %s : %s", d.Kind(), filepath.Join(d.Path(), req.OldName), filepath.Join(to.Path(), req.NewName))
+	if err := validName(req.OldName); err != nil {
+		return err
+	}
+	if err := validName(req.NewName); err != nil {
+		return err
+	}
+	fromDir, err := d.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	defer fromDir.Close()
+	toDir, err := to.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	defer toDir.Close()
+	fi, err := statAt(fromDir, req.OldName)
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	target, _ := statAt(toDir, req.NewName)
+	defer d.fs.changing(d, fromDir)()
+	defer d.fs.changing(to, toDir)()
+	if err := unix.Renameat(int(fromDir.Fd()), req.OldName, int(toDir.Fd()), req.NewName); err != nil {
+		return errorOSToFuse(err)
+	}
+	if target != nil && !os.SameFile(fi, target) {
+		// The file that was replaced lost its name
+		d.fs.unlinked(target, to, req.NewName)
+	}
+	d.fs.moved(fi, d, req.OldName, to, req.NewName)
+	return nil
 }
 
 // File methods
 
-var _ = fs.HandleReader(&Node{})
+var _ = fs.NodeOpener(&Node{})
 
-func (f Node) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
-	log.Printf("FILE READ: %s %v", f.Name(), req)
-	data := resp.Data[:req.Size] // Bazil allocates the data with a capacity of req.Size but initializes its length to 0
-	n, err := f.File.ReadAt(data, int64(req.Offset))
-	resp.Data = data[:n]
-	if err == io.EOF {
-		return nil
+func (n *Node) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	log.Printf("%s OPEN: %s %v", n.Kind(), n.Path(), req)
+	flags := openFlags(req.Flags)
+	if req.Dir {
+		flags = os.O_RDONLY | unix.O_DIRECTORY
+	}
+	file, err := n.open(flags)
+	if err != nil {
+		return nil, errorOSToFuse(err)
 	}
-	return err
+	return newHandle(n, file), nil
 }
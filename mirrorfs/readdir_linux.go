@@ -0,0 +1,66 @@
+package mirrorfs
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"bazil.org/fuse"
+)
+
+// direntBufferSize is the size of the buffer that directory entries are read
+// into.
+const direntBufferSize = 32 * 1024
+
+// readDir returns every entry of the open directory, including "." and "..",
+// starting from the beginning of the directory. It reads the whole directory
+// because ReadDirAll must return every entry at once.
+//
+// The entries are read in batches with getdents, and their types are taken
+// from the entries themselves, so files are only examined individually when
+// the underlying file system does not report their types.
+func readDir(file *os.File, dir string) ([]fuse.Dirent, error) {
+	fd := int(file.Fd())
+	if _, err := syscall.Seek(fd, 0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	var out []fuse.Dirent
+	buf := make([]byte, direntBufferSize)
+	for {
+		n, err := syscall.Getdents(fd, buf)
+		if err != nil {
+			return nil, &os.PathError{Op: "getdents", Path: dir, Err: err}
+		}
+		if n == 0 {
+			return out, nil // End of directory
+		}
+		for pos := 0; pos < n; {
+			de := (*syscall.Dirent)(unsafe.Pointer(&buf[pos]))
+			name := direntName(buf[pos : pos+int(de.Reclen)])
+			pos += int(de.Reclen)
+			typ := fuse.DirentType(de.Type) // See definition of fuse.DirentType for context
+			if de.Type == syscall.DT_UNKNOWN {
+				// The file system does not report types in its directory entries
+				var st unix.Stat_t
+				if err := unix.Fstatat(fd, name, &st, unix.AT_SYMLINK_NOFOLLOW); err == nil {
+					typ = fuse.DirentType(st.Mode & unix.S_IFMT >> 12)
+				}
+			}
+			out = append(out, fuse.Dirent{Inode: de.Ino, Type: typ, Name: name})
+		}
+	}
+}
+
+// direntName returns the name of a directory entry record returned by
+// getdents.
+func direntName(record []byte) string {
+	b := record[unsafe.Offsetof(syscall.Dirent{}.Name):]
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
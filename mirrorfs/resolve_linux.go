@@ -0,0 +1,118 @@
+package mirrorfs
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// resolveFlags confine the resolution of a path by openat2 to the directory
+// it is resolved from. Symbolic links are refused anywhere in the path, which
+// also prevents ".." components from being reached through them.
+const resolveFlags = unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_NO_MAGICLINKS
+
+// noOpenat2 is set once openat2 has been found to be unavailable.
+var noOpenat2 int32
+
+// openBeneath opens the path relative to the directory root without following
+// symbolic links or leaving the directory. The path must be relative and
+// clean.
+//
+// Kernels without openat2 are handled by opening each directory in the path
+// in turn with O_NOFOLLOW.
+func openBeneath(root int, path string, flags int) (int, error) {
+	flags |= unix.O_NOFOLLOW | unix.O_CLOEXEC
+	if atomic.LoadInt32(&noOpenat2) == 0 {
+		fd, err := unix.Openat2(root, path, &unix.OpenHow{Flags: uint64(flags), Resolve: resolveFlags})
+		if err != unix.ENOSYS {
+			return fd, err
+		}
+		atomic.StoreInt32(&noOpenat2, 1)
+	}
+
+	parts := strings.Split(path, "/")
+	dir := root
+	for _, part := range parts[:len(parts)-1] {
+		if part == ".." {
+			return -1, unix.EXDEV // The error openat2 returns for escaping paths
+		}
+		fd, err := unix.Openat(dir, part, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if dir != root {
+			unix.Close(dir)
+		}
+		if err != nil {
+			return -1, err
+		}
+		dir = fd
+	}
+	if parts[len(parts)-1] == ".." {
+		return -1, unix.EXDEV
+	}
+	fd, err := unix.Openat(dir, parts[len(parts)-1], flags, 0)
+	if dir != root {
+		unix.Close(dir)
+	}
+	return fd, err
+}
+
+// openRoot opens the root directory of a file system, which every node is
+// resolved from.
+func openRoot(path string) (*os.File, error) {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// open opens the node with the given flags. The node is resolved beneath the
+// root of the file system, and neither it nor any directory above it is
+// allowed to be a symbolic link.
+func (n *Node) open(flags int) (*os.File, error) {
+	n.fs.mu.Lock()
+	rel, ok := n.relPath()
+	path := n.path()
+	n.fs.mu.Unlock()
+	if !ok {
+		// The node has been removed
+		return nil, &os.PathError{Op: "open", Path: n.name, Err: unix.ENOENT}
+	}
+	fd, err := openBeneath(int(n.fs.rootFile.Fd()), rel, flags)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// openEntry opens the named entry of the directory opened as dir with
+// O_PATH, without following it if it is a symbolic link.
+func openEntry(dir *os.File, name string) (*os.File, error) {
+	path := filepath.Join(dir.Name(), name)
+	fd, err := unix.Openat(int(dir.Fd()), name, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// statAt returns the attributes of the named entry of the directory opened
+// as dir, without following it if it is a symbolic link.
+func statAt(dir *os.File, name string) (os.FileInfo, error) {
+	f, err := openEntry(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// procPath returns a path that refers to the open file. Path based system
+// calls that follow the path act on the file itself, even if it is a symbolic
+// link opened with O_PATH, without resolving its original path again.
+func procPath(f *os.File) string {
+	return "/proc/self/fd/" + strconv.Itoa(int(f.Fd()))
+}
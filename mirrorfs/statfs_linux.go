@@ -0,0 +1,32 @@
+package mirrorfs
+
+import (
+	"log"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+var _ = fs.FSStatfser(&FS{})
+
+// Statfs reports the capacity and usage of the file system containing the
+// root of the mirrored tree.
+func (f *FS) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
+	log.Printf("FS STATFS: %s %v", f.root.name, req)
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(int(f.rootFile.Fd()), &st); err != nil {
+		return errorOSToFuse(err)
+	}
+	resp.Blocks = st.Blocks
+	resp.Bfree = st.Bfree
+	resp.Bavail = st.Bavail
+	resp.Files = st.Files
+	resp.Ffree = st.Ffree
+	resp.Bsize = uint32(st.Bsize)
+	resp.Namelen = uint32(st.Namelen)
+	resp.Frsize = uint32(st.Frsize)
+	return nil
+}
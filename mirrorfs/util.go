@@ -5,18 +5,117 @@ import (
 	"syscall"
 	"time"
 
+	"golang.org/x/sys/unix"
+
 	"bazil.org/fuse"
 )
 
-func direntOSToFuse(fi os.FileInfo, name string) fuse.Dirent {
-	st := fi.Sys().(*syscall.Stat_t)
-	return fuse.Dirent{
-		Inode: st.Ino,
-		Type:  fuse.DirentType(st.Mode & syscall.S_IFMT >> 12), // See definition of fuse.DirentType for context
-		Name:  name,
-	}
-}
+const (
+	utimeNow  = (1 << 30) - 1
+	utimeOmit = (1 << 30) - 2
+)
 
 func timespecToTime(ts syscall.Timespec) time.Time {
 	return time.Unix(int64(ts.Sec), int64(ts.Nsec))
 }
+
+// openFlags returns the flags with which a handle should be opened for the
+// given request flags.
+//
+// The kernel provides an explicit offset for every write, including those
+// made through descriptors opened with O_APPEND, so the flag is removed to
+// prevent the offset from being ignored. Creation and truncation are handled
+// by separate requests.
+func openFlags(flags fuse.OpenFlags) int {
+	return int(flags) &^ (os.O_APPEND | os.O_CREATE | os.O_EXCL | os.O_TRUNC | syscall.O_NOCTTY)
+}
+
+// setOwner assigns ownership of a newly created entry of the directory to the
+// caller. Only a privileged process can do so; otherwise the file keeps the
+// owner assigned by the source file system.
+func setOwner(dir *os.File, name string, header *fuse.Header) {
+	if os.Geteuid() != 0 {
+		return
+	}
+	unix.Fchownat(int(dir.Fd()), name, int(header.Uid), int(header.Gid), unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// setAttr applies the attribute changes in the request to the file at the
+// given path. The path is followed, so it should refer to an open descriptor
+// for the file rather than to the file itself.
+func setAttr(path string, req *fuse.SetattrRequest) error {
+	if req.Valid.Mode() {
+		if err := os.Chmod(path, req.Mode); err != nil {
+			return err
+		}
+	}
+	if req.Valid.Uid() || req.Valid.Gid() {
+		uid, gid := -1, -1
+		if req.Valid.Uid() {
+			uid = int(req.Uid)
+		}
+		if req.Valid.Gid() {
+			gid = int(req.Gid)
+		}
+		if err := os.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	if req.Valid.Size() {
+		if err := os.Truncate(path, int64(req.Size)); err != nil {
+			return err
+		}
+	}
+	if req.Valid.Atime() || req.Valid.Mtime() || req.Valid.AtimeNow() || req.Valid.MtimeNow() {
+		ts := []syscall.Timespec{
+			timeToTimespec(req.Valid.Atime(), req.Valid.AtimeNow(), req.Atime),
+			timeToTimespec(req.Valid.Mtime(), req.Valid.MtimeNow(), req.Mtime),
+		}
+		if err := syscall.UtimesNano(path, ts); err != nil {
+			return &os.PathError{Op: "utimes", Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+// timeToTimespec returns the utimensat representation of a time that may be
+// omitted or set to the current time.
+func timeToTimespec(valid bool, now bool, t time.Time) syscall.Timespec {
+	switch {
+	case now:
+		return syscall.Timespec{Nsec: utimeNow}
+	case valid:
+		return syscall.NsecToTimespec(t.UnixNano())
+	default:
+		return syscall.Timespec{Nsec: utimeOmit}
+	}
+}
+
+// modeOSToUnix converts a file mode to the mode bits used by system calls.
+func modeOSToUnix(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		m |= syscall.S_IFIFO
+	case mode&os.ModeCharDevice != 0:
+		m |= syscall.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		m |= syscall.S_IFBLK
+	case mode&os.ModeSocket != 0:
+		m |= syscall.S_IFSOCK
+	case mode&os.ModeDir != 0:
+		m |= syscall.S_IFDIR
+	default:
+		m |= syscall.S_IFREG
+	}
+	if mode&os.ModeSetuid != 0 {
+		m |= syscall.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= syscall.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= syscall.S_ISVTX
+	}
+	return m
+}
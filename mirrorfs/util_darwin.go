@@ -1,6 +1,7 @@
 package mirrorfs
 
 import (
+	"errors"
 	"os"
 	"syscall"
 	"time"
@@ -8,13 +9,7 @@ import (
 	"bazil.org/fuse"
 )
 
-func attrOSToFuse(f *os.File, a *fuse.Attr) {
-	fi, err := f.Stat()
-	if err != nil {
-		// TODO: Decide how to handle an error here
-		return
-	}
-
+func attrOSToFuse(fi os.FileInfo, a *fuse.Attr) {
 	st := fi.Sys().(*syscall.Stat_t)
 
 	a.Inode = st.Ino
@@ -31,3 +26,11 @@ func attrOSToFuse(f *os.File, a *fuse.Attr) {
 func timespecToTime(ts syscall.Timespec) time.Time {
 	return time.Unix(int64(ts.Sec), int64(ts.Nsec))
 }
+
+// ErrUnsupportedReparsePoint is returned when a reparse point cannot be
+// presented as a symbolic link.
+var ErrUnsupportedReparsePoint = errors.New("Unsupported reparse point")
+
+func readLink(f *os.File) (string, error) {
+	return os.Readlink(f.Name())
+}
@@ -5,16 +5,12 @@ import (
 	"syscall"
 	"unsafe"
 
+	"golang.org/x/sys/unix"
+
 	"bazil.org/fuse"
 )
 
-func attrOSToFuse(f *os.File, a *fuse.Attr) {
-	fi, err := f.Stat()
-	if err != nil {
-		// TODO: Decide how to handle an error here
-		return
-	}
-
+func attrOSToFuse(fi os.FileInfo, a *fuse.Attr) {
 	st := fi.Sys().(*syscall.Stat_t)
 
 	a.Inode = st.Ino
@@ -22,12 +18,9 @@ func attrOSToFuse(f *os.File, a *fuse.Attr) {
 	a.Blocks = uint64(st.Blocks)
 	a.Atime = timespecToTime(st.Atim)
 	a.Mtime = fi.ModTime()
-	a.Ctime = timespecToTime(st.Mtim)
-	// Note: Linux does not store the Crtime, but Atime often happens to be the
-	//       creation time of a file when the file system is mounted with the
-	//       noatime flag. Should we return it here? Perhaps only if it is the
-	//       least of all three values?
-	//a.Crtime = a.Atime
+	a.Ctime = timespecToTime(st.Ctim)
+	// FUSE on Linux cannot carry the creation time: the kernel ignores the
+	// crtime of attributes and never asks to set it
 	a.Mode = fi.Mode()
 	a.Nlink = uint32(st.Nlink) // FIXME: Consider what we should do if Nlink doesn't fit in 32 bits
 	a.Uid = st.Uid
@@ -36,8 +29,97 @@ func attrOSToFuse(f *os.File, a *fuse.Attr) {
 
 func GetFileXAttr(f *os.File, attr string, size uint32, position uint32) ([]byte, error) {
 	// Note: position is always zero for linux build targets
-	fd := int(f.Fd())
-	length, err := fgetxattr(fd, attr, nil) // Get the length of the xattr
+	return getXAttr(func(dest []byte) (int, error) {
+		return fgetxattr(int(f.Fd()), attr, dest)
+	}, size)
+}
+
+func ListFileXAttr(f *os.File, size uint32, position uint32) ([]byte, error) {
+	// Note: position is always zero for linux build targets
+	return listXAttr(func(dest []byte) (int, error) {
+		return flistxattr(int(f.Fd()), dest)
+	}, size)
+}
+
+func SetFileXAttr(f *os.File, attr string, data []byte, flags uint32, position uint32) error {
+	// Note: position is always zero for linux build targets
+	if err := fsetxattr(int(f.Fd()), attr, data, int(flags)); err != nil {
+		return errorOSToFuse(err)
+	}
+	return nil
+}
+
+func RemoveFileXAttr(f *os.File, attr string) error {
+	if err := fremovexattr(int(f.Fd()), attr); err != nil {
+		return errorOSToFuse(err)
+	}
+	return nil
+}
+
+// GetXAttr returns the value of an extended attribute of the node. Symbolic
+// links are not followed.
+func (n *Node) GetXAttr(attr string, size uint32, position uint32) ([]byte, error) {
+	// Note: position is always zero for linux build targets
+	f, err := n.open(unix.O_PATH)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	defer f.Close()
+	path := procPath(f)
+	return getXAttr(func(dest []byte) (int, error) {
+		return unix.Getxattr(path, attr, dest)
+	}, size)
+}
+
+// ListXAttr returns the list of extended attributes of the node.
+func (n *Node) ListXAttr(size uint32, position uint32) ([]byte, error) {
+	// Note: position is always zero for linux build targets
+	f, err := n.open(unix.O_PATH)
+	if err != nil {
+		return nil, errorOSToFuse(err)
+	}
+	defer f.Close()
+	path := procPath(f)
+	return listXAttr(func(dest []byte) (int, error) {
+		return unix.Listxattr(path, dest)
+	}, size)
+}
+
+// SetXAttr sets the value of an extended attribute of the node.
+func (n *Node) SetXAttr(attr string, data []byte, flags uint32, position uint32) error {
+	// Note: position is always zero for linux build targets
+	f, err := n.open(unix.O_PATH)
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	defer f.Close()
+	if err := unix.Setxattr(procPath(f), attr, data, int(flags)); err != nil {
+		return errorOSToFuse(err)
+	}
+	// Extended attributes of the underlying file system, such as the NTFS
+	// attributes and ACL of ntfs-3g, may determine the mode of the file
+	n.fs.invalidateAttr(n)
+	return nil
+}
+
+// RemoveXAttr removes an extended attribute from the node.
+func (n *Node) RemoveXAttr(attr string) error {
+	f, err := n.open(unix.O_PATH)
+	if err != nil {
+		return errorOSToFuse(err)
+	}
+	defer f.Close()
+	if err := unix.Removexattr(procPath(f), attr); err != nil {
+		return errorOSToFuse(err)
+	}
+	n.fs.invalidateAttr(n)
+	return nil
+}
+
+// getXAttr reads an extended attribute with the given getxattr system call,
+// which is passed the buffer to fill.
+func getXAttr(getxattr func(dest []byte) (int, error), size uint32) ([]byte, error) {
+	length, err := getxattr(nil) // Get the length of the xattr
 	if err != nil {
 		//log.Print(err)
 		return nil, errorOSToFuse(err)
@@ -58,7 +140,7 @@ func GetFileXAttr(f *os.File, attr string, size uint32, position uint32) ([]byte
 	}
 	for i := 0; i < 5; i++ {
 		buffer := make([]byte, length)
-		newLength, err := fgetxattr(fd, attr, buffer) // Get the xattr bytes
+		newLength, err := getxattr(buffer) // Get the xattr bytes
 		if newLength > int(size) {
 			return nil, fuse.ERANGE
 		}
@@ -89,10 +171,10 @@ func GetFileXAttr(f *os.File, attr string, size uint32, position uint32) ([]byte
 	return nil, fuse.ERANGE // Too many ERANGE errors (should be an exceedingly rare case)
 }
 
-func ListFileXAttr(f *os.File, size uint32, position uint32) ([]byte, error) {
-	// Note: position is always zero for linux build targets
-	fd := int(f.Fd())
-	length, err := flistxattr(fd, nil) // Get the length of the xattr
+// listXAttr reads an extended attribute list with the given listxattr system
+// call, which is passed the buffer to fill.
+func listXAttr(listxattr func(dest []byte) (int, error), size uint32) ([]byte, error) {
+	length, err := listxattr(nil) // Get the length of the xattr
 	if err != nil {
 		//log.Print(err)
 		return nil, errorOSToFuse(err)
@@ -114,7 +196,7 @@ func ListFileXAttr(f *os.File, size uint32, position uint32) ([]byte, error) {
 	// Race conditions could lead to us allocating a buffer that is too small; we'll make up to 5 attempts to get it right
 	for i := 0; i < 5; i++ {
 		buffer := make([]byte, length)
-		newLength, err := flistxattr(fd, buffer) // Get the xattr list bytes
+		newLength, err := listxattr(buffer) // Get the xattr list bytes
 		if newLength > int(size) {
 			return nil, fuse.ERANGE
 		}
@@ -145,30 +227,42 @@ func ListFileXAttr(f *os.File, size uint32, position uint32) ([]byte, error) {
 	return nil, fuse.ERANGE // Too many ERANGE errors (should be an exceedingly rare case)
 }
 
+// errorOSToFuse returns the error to report to the kernel for an error
+// returned by the os or syscall packages. The error number of a failed
+// system call is passed through unchanged, so the caller sees the same error
+// that it would have seen when accessing the source tree directly.
 func errorOSToFuse(err error) error {
-	switch err {
-	case syscall.ENOSYS:
-		return fuse.ENOSYS
-	case syscall.ESTALE:
-		return fuse.ESTALE
-	case syscall.ENOENT:
-		return fuse.ENOENT
-	case syscall.EIO:
-		return fuse.EIO
-	case syscall.EPERM:
-		return fuse.EPERM
-	case syscall.EINTR:
-		return fuse.EINTR
-	case syscall.ERANGE:
-		return fuse.ERANGE
-	case syscall.ENOTSUP:
-		return fuse.ENOTSUP
-	case syscall.EEXIST:
-		return fuse.EEXIST
-	case syscall.ENODATA:
-		return fuse.ENODATA
-	default:
-		return err
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+	if errno, ok := err.(syscall.Errno); ok {
+		return fuse.Errno(errno)
+	}
+	return err
+}
+
+// getxattrAll returns the full value of an extended attribute of the file at
+// the given path.
+func getxattrAll(path string, attr string) ([]byte, error) {
+	for {
+		length, err := unix.Getxattr(path, attr, nil)
+		if err != nil {
+			return nil, err
+		}
+		buffer := make([]byte, length)
+		length, err = unix.Getxattr(path, attr, buffer)
+		if err == syscall.ERANGE {
+			continue // The attribute grew between the two calls
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buffer[:length], nil
 	}
 }
 
@@ -210,6 +304,40 @@ func flistxattr(fd int, dest []byte) (sz int, err error) {
 	return
 }
 
+// http://man7.org/linux/man-pages/man2/setxattr.2.html
+func fsetxattr(fd int, attr string, data []byte, flags int) (err error) {
+	var _p0 *byte
+	_p0, err = syscall.BytePtrFromString(attr)
+	if err != nil {
+		return
+	}
+	var _p1 unsafe.Pointer
+	if len(data) > 0 {
+		_p1 = unsafe.Pointer(&data[0])
+	} else {
+		_p1 = unsafe.Pointer(&_zero)
+	}
+	_, _, e1 := syscall.Syscall6(syscall.SYS_FSETXATTR, uintptr(fd), uintptr(unsafe.Pointer(_p0)), uintptr(_p1), uintptr(len(data)), uintptr(flags), 0)
+	if e1 != 0 {
+		err = e1
+	}
+	return
+}
+
+// http://man7.org/linux/man-pages/man2/removexattr.2.html
+func fremovexattr(fd int, attr string) (err error) {
+	var _p0 *byte
+	_p0, err = syscall.BytePtrFromString(attr)
+	if err != nil {
+		return
+	}
+	_, _, e1 := syscall.Syscall(syscall.SYS_FREMOVEXATTR, uintptr(fd), uintptr(unsafe.Pointer(_p0)), 0)
+	if e1 != 0 {
+		err = e1
+	}
+	return
+}
+
 var _zero uintptr
 
 // use is a no-op, but the compiler cannot see that it is.
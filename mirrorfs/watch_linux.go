@@ -0,0 +1,469 @@
+package mirrorfs
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchMask selects the inotify events that indicate a change to a directory
+// or to one of its entries.
+const watchMask = unix.IN_ATTRIB | unix.IN_MODIFY | unix.IN_CREATE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+
+// watchBufferSize is the size of the buffer that inotify events are read
+// into. Every change described by a single read is reported to the kernel
+// once.
+const watchBufferSize = 64 * 1024
+
+// watcher reports changes that are made to the source tree other than through
+// the file system to the kernel, so that it does not keep serving attributes,
+// entries and data from its caches after they have changed.
+//
+// Every directory that the kernel knows of is watched with inotify, which
+// reports changes as they are made through the mount of the underlying file
+// system that the tree is mirrored from. Changes made through another mount
+// of the same volume, such as a second ntfs-3g mount, are not visible to
+// inotify. They are caught by polling the files whose attributes the kernel
+// has cached instead.
+type watcher struct {
+	fs   *FS
+	file *os.File
+	done chan struct{}
+
+	mu     sync.Mutex
+	dirs   map[int32]*Node // By watch descriptor
+	watch  map[*Node]int32
+	stamps map[*Node]stamp // As last reported to the kernel
+	busy   map[*Node]int   // The number of changes being made by the file system
+}
+
+// stamp records the times and size of a file, which change along with its
+// contents or, for a directory, its entries. The status change time also
+// changes along with its attributes, including its ACLs.
+type stamp struct {
+	ctime syscall.Timespec
+	mtime syscall.Timespec
+	size  int64
+}
+
+func newStamp(fi os.FileInfo) stamp {
+	st := fi.Sys().(*syscall.Stat_t)
+	return stamp{ctime: st.Ctim, mtime: st.Mtim, size: st.Size}
+}
+
+// dataChanged returns true if the contents or entries of the file have
+// changed between the stamps.
+func (s stamp) dataChanged(old stamp) bool {
+	return s.mtime != old.mtime || s.size != old.size
+}
+
+// change describes what has changed about a node.
+type change int
+
+const (
+	changedAttr change = 1 << iota
+	changedData        // The contents of a file or the entries of a directory
+)
+
+// entry identifies a name within a directory.
+type entry struct {
+	dir  *Node
+	name string
+}
+
+// Watch starts reporting changes that are made to the source tree other than
+// through the file system. Changes that inotify does not see are found by
+// checking the files known to the kernel every PollInterval. It must be
+// called before the file system is served.
+func (f *FS) Watch() error {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	w := &watcher{
+		fs:     f,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		done:   make(chan struct{}),
+		dirs:   make(map[int32]*Node),
+		watch:  make(map[*Node]int32),
+		stamps: make(map[*Node]stamp),
+		busy:   make(map[*Node]int),
+	}
+	f.watcher = w
+	if err := w.add(f.root); err != nil {
+		w.file.Close()
+		f.watcher = nil
+		return err
+	}
+	go w.run()
+	if f.PollInterval > 0 {
+		go w.poll(f.PollInterval)
+	}
+	return nil
+}
+
+// watchDir starts watching the node if it is a directory.
+func (f *FS) watchDir(n *Node) {
+	if f.watcher == nil || !n.IsDir() {
+		return
+	}
+	if err := f.watcher.add(n); err != nil {
+		log.Printf("%s WATCH: %s: %v", n.Kind(), n.Path(), err)
+	}
+}
+
+// unwatch stops watching the node once the kernel no longer refers to it.
+func (f *FS) unwatch(n *Node) {
+	if f.watcher == nil {
+		return
+	}
+	if n.IsDir() {
+		f.watcher.remove(n)
+	}
+	f.watcher.mu.Lock()
+	delete(f.watcher.stamps, n)
+	f.watcher.mu.Unlock()
+}
+
+// changing marks the node as being changed by the file system itself until
+// the returned function is called, once the change to the file opened as file
+// or, for a directory, to its entries is complete. The function records the
+// resulting attributes of the node.
+//
+// The kernel already knows about such changes, so neither inotify, poll nor
+// revalidate must mistake them for changes made to the source tree directly:
+// discarding the data that the kernel has cached would throw away the pages
+// that were just written through it. A change that is made to the source tree
+// directly while the node is being changed goes unnoticed until the file
+// changes again.
+func (f *FS) changing(n *Node, file *os.File) (done func()) {
+	w := f.watcher
+	if w == nil {
+		return func() {}
+	}
+	w.mu.Lock()
+	w.busy[n]++
+	w.mu.Unlock()
+	return func() {
+		fi, err := file.Stat()
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if err == nil {
+			w.stamps[n] = newStamp(fi)
+		}
+		w.busy[n]--
+		if w.busy[n] == 0 {
+			delete(w.busy, n)
+		}
+	}
+}
+
+// current returns true if the node is being changed by the file system
+// itself or its file is unchanged since its attributes were last recorded, in
+// which case a change that inotify reported for it was made through the file
+// system. Otherwise the attributes are recorded anew, since the kernel is
+// about to be told of the change.
+func (w *watcher) current(n *Node) bool {
+	fi, err := n.Stat()
+	if err != nil {
+		return false
+	}
+	s := newStamp(fi)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	old, ok := w.stamps[n]
+	if w.busy[n] > 0 || ok && old == s {
+		return true
+	}
+	if ok {
+		w.stamps[n] = s
+	}
+	return false
+}
+
+// revalidate records the attributes of the node that are about to be
+// reported to the kernel, against which poll compares the file. If its
+// contents or entries have changed since they were last reported the kernel
+// is also told to discard the data it has cached for the node. Changes made
+// through the file system itself are recorded by changing, so they do not
+// cost the kernel its cached data.
+func (f *FS) revalidate(n *Node, fi os.FileInfo) {
+	w := f.watcher
+	if w == nil {
+		return
+	}
+	s := newStamp(fi)
+	w.mu.Lock()
+	old, ok := w.stamps[n]
+	w.stamps[n] = s
+	busy := w.busy[n] > 0
+	w.mu.Unlock()
+	if ok && !busy && s.dataChanged(old) {
+		// The kernel is waiting for the attributes, so the data is discarded
+		// once they have been sent rather than while it waits
+		go f.invalidateData(n)
+	}
+}
+
+// poll checks the files whose attributes the kernel has cached for changes
+// every interval until the watcher is closed.
+func (w *watcher) poll(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// check reports the files that have changed since their attributes were last
+// reported to the kernel. A directory whose entries have changed has the
+// names of the files that the kernel has looked up in it invalidated, since
+// the changed names are not known.
+func (w *watcher) check() {
+	w.mu.Lock()
+	nodes := make([]*Node, 0, len(w.stamps))
+	for n := range w.stamps {
+		nodes = append(nodes, n)
+	}
+	w.mu.Unlock()
+
+	for _, n := range nodes {
+		fi, err := n.Stat()
+		if err != nil {
+			// The file has been removed, or its directory renamed. It is checked
+			// again once the kernel has looked it up again.
+			w.mu.Lock()
+			delete(w.stamps, n)
+			w.mu.Unlock()
+			w.fs.mu.Lock()
+			dir, name := n.parent, n.name
+			w.fs.mu.Unlock()
+			if dir != nil {
+				w.fs.invalidateEntry(dir, name)
+			}
+			continue
+		}
+		s := newStamp(fi)
+		w.mu.Lock()
+		old, ok := w.stamps[n]
+		if w.busy[n] > 0 {
+			// The stamp is recorded once the change is complete
+			ok = false
+		} else if ok {
+			w.stamps[n] = s
+		}
+		w.mu.Unlock()
+		switch {
+		case !ok || s == old:
+		case s.dataChanged(old):
+			w.fs.invalidateData(n)
+			if n.IsDir() {
+				for _, name := range w.fs.children(n) {
+					w.fs.invalidateEntry(n, name)
+				}
+			}
+		default:
+			w.fs.invalidateAttr(n)
+		}
+	}
+}
+
+// children returns the names of the files in the directory that the kernel
+// knows of.
+func (f *FS) children(dir *Node) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, n := range f.nodes {
+		if n.parent == dir {
+			names = append(names, n.name)
+		}
+	}
+	return names
+}
+
+func (w *watcher) add(n *Node) error {
+	w.mu.Lock()
+	_, ok := w.watch[n]
+	w.mu.Unlock()
+	if ok {
+		return nil
+	}
+	dir, err := n.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	wd, err := unix.InotifyAddWatch(int(w.file.Fd()), procPath(dir), watchMask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if old, ok := w.dirs[int32(wd)]; ok && old != n {
+		// The directory is already watched for an older node of the same file
+		delete(w.watch, old)
+	}
+	w.dirs[int32(wd)] = n
+	w.watch[n] = int32(wd)
+	return nil
+}
+
+func (w *watcher) remove(n *Node) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wd, ok := w.watch[n]
+	if !ok {
+		return
+	}
+	delete(w.watch, n)
+	delete(w.dirs, wd)
+	unix.InotifyRmWatch(int(w.file.Fd()), uint32(wd))
+}
+
+// run reads events until the watcher is closed.
+func (w *watcher) run() {
+	buf := make([]byte, watchBufferSize)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Printf("FS WATCH: %v", err)
+			}
+			return
+		}
+		w.handle(buf[:n])
+	}
+}
+
+// handle reports the changes described by a batch of events. Events for
+// changes that were made through the file system itself are ignored.
+func (w *watcher) handle(buf []byte) {
+	entries := make(map[entry]bool)    // Names that were added or removed
+	children := make(map[entry]change) // Names whose files have changed
+	nodes := make(map[*Node]change)
+	own := make(map[*Node]bool) // Whether the changes to a node were our own
+	ownChange := func(n *Node) bool {
+		v, ok := own[n]
+		if !ok {
+			v = w.current(n)
+			own[n] = v
+		}
+		return v
+	}
+	for pos := 0; pos+unix.SizeofInotifyEvent <= len(buf); {
+		ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[pos]))
+		name := eventName(buf[pos+unix.SizeofInotifyEvent : pos+unix.SizeofInotifyEvent+int(ev.Len)])
+		pos += unix.SizeofInotifyEvent + int(ev.Len)
+
+		if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+			// Events were lost, so nothing that is cached can be trusted
+			w.fs.invalidateAll()
+			continue
+		}
+		w.mu.Lock()
+		dir, ok := w.dirs[ev.Wd]
+		if ev.Mask&unix.IN_IGNORED != 0 && ok {
+			// The directory was removed or is no longer watched
+			delete(w.dirs, ev.Wd)
+			delete(w.watch, dir)
+		}
+		w.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "":
+			if ev.Mask&unix.IN_ATTRIB != 0 {
+				nodes[dir] |= changedAttr
+			}
+		case ev.Mask&(unix.IN_CREATE|unix.IN_DELETE|unix.IN_MOVED_FROM|unix.IN_MOVED_TO) != 0:
+			entries[entry{dir, name}] = true
+			nodes[dir] |= changedData
+		case ev.Mask&unix.IN_MODIFY != 0:
+			children[entry{dir, name}] |= changedData
+		case ev.Mask&unix.IN_ATTRIB != 0:
+			// Includes changes to extended attributes, such as ACLs
+			children[entry{dir, name}] |= changedAttr
+		}
+	}
+
+	for e := range entries {
+		if ownChange(e.dir) {
+			continue
+		}
+		w.fs.invalidateEntry(e.dir, e.name)
+		if n, ok := w.fs.knownEntry(e.dir, e.name); ok {
+			// A file that is known under another name was moved or linked here
+			nodes[n] |= changedAttr
+		}
+	}
+	for e, c := range children {
+		if n, ok := w.fs.knownEntry(e.dir, e.name); ok {
+			nodes[n] |= c
+		}
+	}
+	for n, c := range nodes {
+		if ownChange(n) {
+			continue
+		}
+		if c&changedData != 0 {
+			w.fs.invalidateData(n)
+		} else {
+			w.fs.invalidateAttr(n)
+		}
+	}
+}
+
+// eventName returns the name carried by an inotify event, which is padded
+// with null bytes.
+func eventName(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// knownEntry returns the node of the file found with the given name in dir,
+// if the kernel knows of it, and moves the node to that name.
+func (f *FS) knownEntry(d *Node, name string) (*Node, bool) {
+	dir, err := d.open(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return nil, false
+	}
+	defer dir.Close()
+	fi, err := statAt(dir, name)
+	if err != nil {
+		return nil, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.nodes[statID(fi)]
+	if !ok || n.mode != fi.Mode()&os.ModeType {
+		return nil, false
+	}
+	if n != f.root {
+		n.parent, n.name = d, name
+	}
+	return n, true
+}
+
+func (w *watcher) close() error {
+	close(w.done)
+	return w.file.Close()
+}
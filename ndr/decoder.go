@@ -0,0 +1,172 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrTruncated is returned when the data ends before the decoder has read
+// everything it expected.
+var ErrTruncated = errors.New("NDR data has been corrupted or truncated")
+
+// Decoder reads NDR encoded data from a byte slice.
+//
+// Decoding errors are sticky: once an error has occurred every subsequent
+// read returns a zero value, and the error is reported by Err.
+type Decoder struct {
+	data    []byte
+	offset  int
+	noAlign bool
+	err     error
+}
+
+// NewDecoder returns a decoder that reads from the given data.
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Err returns the first error encountered by the decoder.
+func (d *Decoder) Err() error { return d.err }
+
+// Offset returns the offset of the next byte to be read.
+func (d *Decoder) Offset() int { return d.offset }
+
+// Remaining returns the bytes that have not been read yet.
+func (d *Decoder) Remaining() []byte {
+	if d.offset > len(d.data) {
+		return nil
+	}
+	return d.data[d.offset:]
+}
+
+// SetNoAlign enables or disables alignment padding, which corresponds to the
+// NDR_NOALIGN flag in Samba's IDL. It returns the previous setting so that it
+// can be restored when the flagged structure has been read.
+func (d *Decoder) SetNoAlign(noAlign bool) (previous bool) {
+	previous = d.noAlign
+	d.noAlign = noAlign
+	return
+}
+
+// Align skips padding until the offset is a multiple of n.
+func (d *Decoder) Align(n int) {
+	if d.noAlign || d.err != nil {
+		return
+	}
+	offset := (d.offset + n - 1) &^ (n - 1)
+	if offset > len(d.data) {
+		d.err = ErrTruncated
+		return
+	}
+	d.offset = offset
+}
+
+// next returns the next n bytes and advances the offset past them.
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.offset+n > len(d.data) {
+		d.err = ErrTruncated
+		return nil
+	}
+	b := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return b
+}
+
+// Uint8 reads an unsigned 8-bit integer.
+func (d *Decoder) Uint8() uint8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// Uint16 reads an unsigned 16-bit integer aligned to 2 bytes.
+func (d *Decoder) Uint16() uint16 {
+	d.Align(2)
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+// Uint32 reads an unsigned 32-bit integer aligned to 4 bytes.
+func (d *Decoder) Uint32() uint32 {
+	d.Align(4)
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+// Udlong reads an unsigned 64-bit integer aligned to 4 bytes. This is the
+// representation used for NTTIME values.
+func (d *Decoder) Udlong() uint64 {
+	d.Align(4)
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+// Hyper reads an unsigned 64-bit integer aligned to 8 bytes.
+func (d *Decoder) Hyper() uint64 {
+	d.Align(8)
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+// FixedArray reads a fixed size array of bytes. The returned slice is a copy.
+func (d *Decoder) FixedArray(size int) []byte {
+	b := d.next(size)
+	if b == nil {
+		return nil
+	}
+	out := make([]byte, size)
+	copy(out, b)
+	return out
+}
+
+// NullTermString reads a null terminated string without a length prefix.
+func (d *Decoder) NullTermString() string {
+	if d.err != nil {
+		return ""
+	}
+	t := bytes.IndexByte(d.Remaining(), 0)
+	if t < 0 {
+		d.err = ErrTruncated
+		return ""
+	}
+	s := string(d.data[d.offset : d.offset+t])
+	d.offset += t + 1
+	return s
+}
+
+// DataBlob reads a length-prefixed byte blob. The returned slice is a copy.
+func (d *Decoder) DataBlob() []byte {
+	length := d.Uint32()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(length) > uint64(len(d.data)-d.offset) {
+		d.err = ErrTruncated
+		return nil
+	}
+	return d.FixedArray(int(length))
+}
+
+// UniquePtr reads the referent identifier of a unique pointer and reports
+// whether the pointer is present.
+func (d *Decoder) UniquePtr() bool {
+	return d.Uint32() != 0
+}
@@ -0,0 +1,16 @@
+/*
+Package ndr implements the subset of the DCE/RPC network data representation
+(NDR) that Samba uses to encode the data it stores in extended attributes and
+trivial databases.
+
+Only little-endian NDR20 transfer syntax is supported. Encoders and decoders
+track natural alignment and the referent identifiers of unique pointers the
+same way Samba's libndr does, so that structures built with this package
+match the output of ndrdump byte-for-byte.
+
+Like code generated by pidl, callers are responsible for ordering the
+scalar and deferred (buffer) portions of each structure. A unique pointer is
+represented by a referent written with UniquePtr in the scalar portion,
+followed later by the pointed-to data in the buffer portion.
+*/
+package ndr
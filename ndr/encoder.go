@@ -0,0 +1,125 @@
+package ndr
+
+import "encoding/binary"
+
+const (
+	// referentBase is the value of the first unique pointer referent
+	// identifier emitted by Samba's libndr. Each subsequent non-NULL pointer
+	// increments the identifier by four.
+	referentBase = 0x00020000
+)
+
+// Encoder writes NDR encoded data to a growing byte slice.
+type Encoder struct {
+	data     []byte
+	ptrCount uint32
+	noAlign  bool
+}
+
+// NewEncoder returns an empty encoder.
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// Bytes returns the encoded data.
+func (e *Encoder) Bytes() []byte { return e.data }
+
+// Len returns the number of bytes encoded so far.
+func (e *Encoder) Len() int { return len(e.data) }
+
+// SetNoAlign enables or disables alignment padding, which corresponds to the
+// NDR_NOALIGN flag in Samba's IDL. It returns the previous setting so that it
+// can be restored when the flagged structure has been written.
+func (e *Encoder) SetNoAlign(noAlign bool) (previous bool) {
+	previous = e.noAlign
+	e.noAlign = noAlign
+	return
+}
+
+// Align pads the data with zero bytes until its length is a multiple of n.
+func (e *Encoder) Align(n int) {
+	if e.noAlign {
+		return
+	}
+	for len(e.data)%n != 0 {
+		e.data = append(e.data, 0)
+	}
+}
+
+// Uint8 writes an unsigned 8-bit integer.
+func (e *Encoder) Uint8(v uint8) {
+	e.data = append(e.data, v)
+}
+
+// Uint16 writes an unsigned 16-bit integer aligned to 2 bytes.
+func (e *Encoder) Uint16(v uint16) {
+	e.Align(2)
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	e.data = append(e.data, b[:]...)
+}
+
+// Uint32 writes an unsigned 32-bit integer aligned to 4 bytes.
+func (e *Encoder) Uint32(v uint32) {
+	e.Align(4)
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	e.data = append(e.data, b[:]...)
+}
+
+// Udlong writes an unsigned 64-bit integer aligned to 4 bytes. This is the
+// representation used for NTTIME values.
+func (e *Encoder) Udlong(v uint64) {
+	e.Align(4)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.data = append(e.data, b[:]...)
+}
+
+// Hyper writes an unsigned 64-bit integer aligned to 8 bytes.
+func (e *Encoder) Hyper(v uint64) {
+	e.Align(8)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.data = append(e.data, b[:]...)
+}
+
+// FixedArray writes the bytes of a fixed size array. If v is shorter than
+// size the remainder is padded with zeros.
+func (e *Encoder) FixedArray(v []byte, size int) {
+	start := len(e.data)
+	e.data = append(e.data, make([]byte, size)...)
+	copy(e.data[start:], v)
+}
+
+// Raw appends bytes without any length or alignment, which is how Samba
+// writes structures carried as opaque subcontexts.
+func (e *Encoder) Raw(v []byte) {
+	e.data = append(e.data, v...)
+}
+
+// NullTermString writes a null terminated string without a length prefix.
+// This corresponds to strings flagged with STR_NULLTERM in Samba's IDL.
+func (e *Encoder) NullTermString(s string) {
+	e.data = append(e.data, s...)
+	e.data = append(e.data, 0)
+}
+
+// DataBlob writes a length-prefixed byte blob. This corresponds to the
+// DATA_BLOB type in Samba's IDL.
+func (e *Encoder) DataBlob(v []byte) {
+	e.Uint32(uint32(len(v)))
+	e.data = append(e.data, v...)
+}
+
+// UniquePtr writes the referent identifier for a unique pointer. A present
+// pointer is assigned the next referent identifier while an absent one is
+// encoded as zero.
+func (e *Encoder) UniquePtr(present bool) {
+	if !present {
+		e.Uint32(0)
+		return
+	}
+	e.Uint32(referentBase + e.ptrCount*4)
+	e.ptrCount++
+}
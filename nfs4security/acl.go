@@ -0,0 +1,133 @@
+package nfs4security
+
+// The names of the extended attributes in which NFSv4 ACLs are stored.
+const (
+	// NFSXAttrName is the attribute through which the Linux NFS client
+	// exposes the ACLs of files on NFSv4 servers.
+	NFSXAttrName = "system.nfs4_acl"
+
+	// XDRXAttrName is the attribute in which vfs_nfs4acl_xattr stores ACLs
+	// in its XDR encoding.
+	XDRXAttrName = "security.nfs4acl_xdr"
+
+	// NDRXAttrName is the attribute in which vfs_nfs4acl_xattr stores ACLs
+	// in its NDR encoding.
+	NDRXAttrName = "security.nfs4acl"
+)
+
+// ACEType specifies whether an ACE allows, denies, audits or raises an alarm
+// for access.
+type ACEType uint32
+
+const (
+	AccessAllowedACEType ACEType = 0
+	AccessDeniedACEType  ACEType = 1
+	SystemAuditACEType   ACEType = 2
+	SystemAlarmACEType   ACEType = 3
+)
+
+// ACEFlag holds the inheritance and audit flags of an ACE, and whether it
+// identifies a group.
+type ACEFlag uint32
+
+// HasFlag returns true if the flags contain the given flag.
+func (value ACEFlag) HasFlag(flag ACEFlag) bool {
+	return value&flag == flag
+}
+
+const (
+	FileInheritACE          ACEFlag = 0x00000001
+	DirectoryInheritACE     ACEFlag = 0x00000002
+	NoPropagateInheritACE   ACEFlag = 0x00000004
+	InheritOnlyACE          ACEFlag = 0x00000008
+	SuccessfulAccessACEFlag ACEFlag = 0x00000010
+	FailedAccessACEFlag     ACEFlag = 0x00000020
+	IdentifierGroup         ACEFlag = 0x00000040
+	InheritedACE            ACEFlag = 0x00000080 // NFSv4.1 only
+)
+
+// AccessMask holds the permissions of an ACE. The permissions share their
+// values with the corresponding NT access rights.
+type AccessMask uint32
+
+const (
+	ReadData           AccessMask = 0x00000001
+	ListDirectory      AccessMask = 0x00000001
+	WriteData          AccessMask = 0x00000002
+	AddFile            AccessMask = 0x00000002
+	AppendData         AccessMask = 0x00000004
+	AddSubdirectory    AccessMask = 0x00000004
+	ReadNamedAttrs     AccessMask = 0x00000008
+	WriteNamedAttrs    AccessMask = 0x00000010
+	Execute            AccessMask = 0x00000020
+	DeleteChild        AccessMask = 0x00000040
+	ReadAttributes     AccessMask = 0x00000080
+	WriteAttributes    AccessMask = 0x00000100
+	WriteRetention     AccessMask = 0x00000200
+	WriteRetentionHold AccessMask = 0x00000400
+	Delete             AccessMask = 0x00010000
+	ReadACL            AccessMask = 0x00020000
+	WriteACL           AccessMask = 0x00040000
+	WriteOwner         AccessMask = 0x00080000
+	Synchronize        AccessMask = 0x00100000
+	validAccessMask    AccessMask = 0x001f07ff
+)
+
+// ACLFlag holds the flags of an NFSv4.1 ACL.
+type ACLFlag uint32
+
+const (
+	AutoInheritACL ACLFlag = 0x00000001
+	ProtectedACL   ACLFlag = 0x00000002
+	DefaultedACL   ACLFlag = 0x00000004
+
+	// WriteThroughACL and MaskedACL are only used by richacls; see RichACL.
+	WriteThroughACL ACLFlag = 0x00000040
+	MaskedACL       ACLFlag = 0x00000080
+)
+
+// SpecialWho identifies the special principals of NFSv4 ACEs.
+type SpecialWho uint32
+
+const (
+	// NotSpecial marks an ACE that identifies a user or, with the
+	// IdentifierGroup flag, a group by ID.
+	NotSpecial SpecialWho = 0
+
+	// Owner is OWNER@, the owner of the file.
+	Owner SpecialWho = 1
+
+	// Group is GROUP@, the group of the file.
+	Group SpecialWho = 2
+
+	// Everyone is EVERYONE@, which includes the owner and group.
+	Everyone SpecialWho = 3
+)
+
+// The names of the special principals in system.nfs4_acl.
+var specialNames = map[SpecialWho]string{
+	Owner:    "OWNER@",
+	Group:    "GROUP@",
+	Everyone: "EVERYONE@",
+}
+
+func (w SpecialWho) String() string {
+	return specialNames[w]
+}
+
+// An ACE is an entry of an NFSv4 ACL. It applies to the special principal
+// if Special is set and otherwise to the user or group identified by ID.
+type ACE struct {
+	Type    ACEType
+	Flags   ACEFlag
+	Mask    AccessMask
+	Special SpecialWho
+	ID      uint32
+}
+
+// An ACL is an NFSv4 access control list. Flags are only encoded by the
+// formats of NFSv4.1 ACLs.
+type ACL struct {
+	Flags   ACLFlag
+	Entries []ACE
+}
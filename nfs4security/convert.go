@@ -0,0 +1,217 @@
+package nfs4security
+
+import (
+	"go.scj.io/samba-over-ntfs/idmap"
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// The flags of NT ACEs and the NFSv4 flags they correspond to.
+var flagMapping = []struct {
+	nt   ntsecurity.AccessControlFlag
+	nfs4 ACEFlag
+}{
+	{ntsecurity.ObjectInheritFlag, FileInheritACE},
+	{ntsecurity.ContainerInheritFlag, DirectoryInheritACE},
+	{ntsecurity.NoPropagateInheritFlag, NoPropagateInheritACE},
+	{ntsecurity.InheritOnlyFlag, InheritOnlyACE},
+	{ntsecurity.InheritedFlag, InheritedACE},
+	{ntsecurity.SuccessfulAccessFlag, SuccessfulAccessACEFlag},
+	{ntsecurity.FailedAccessFlag, FailedAccessACEFlag},
+}
+
+// The control flags of NT security descriptors and the NFSv4.1 ACL flags
+// they correspond to.
+var controlMapping = []struct {
+	nt   ntsecurity.SecurityDescriptorControl
+	nfs4 ACLFlag
+}{
+	{ntsecurity.DACLAutoInherited, AutoInheritACL},
+	{ntsecurity.DACLProtected, ProtectedACL},
+	{ntsecurity.DACLDefaulted, DefaultedACL},
+}
+
+// The types of NT ACEs and the NFSv4 types they correspond to.
+var typeMapping = map[ntsecurity.AccessControlType]ACEType{
+	ntsecurity.AccessAllowedControl: AccessAllowedACEType,
+	ntsecurity.AccessDeniedControl:  AccessDeniedACEType,
+	ntsecurity.SystemAuditControl:   SystemAuditACEType,
+	ntsecurity.SystemAlarmControl:   SystemAlarmACEType,
+}
+
+// FromSecurityDescriptor converts the DACL and SACL of the security
+// descriptor into an NFSv4 ACL, in which the entries of the SACL follow those
+// of the DACL. A security descriptor without a DACL is converted into an ACL
+// that grants everything to EVERYONE@.
+//
+// Everyone (S-1-1-0) becomes EVERYONE@, and CREATOR OWNER (S-1-3-0) and
+// CREATOR GROUP (S-1-3-1) become OWNER@ and GROUP@ in entries that are only
+// inherited, since they only stand for the owner and group of the objects
+// that inherit them. Other SIDs are resolved to uids and gids by the
+// mapping, which may be nil; see idmap.ResolveSID. Generic rights are
+// replaced by the rights they stand for, and rights that NFSv4 lacks, such
+// as ACCESS_SYSTEM_SECURITY, are left out.
+//
+// Entries that NFSv4 cannot represent, which are object entries, entries
+// of other types, entries for SIDs that cannot be resolved and CREATOR OWNER
+// and CREATOR GROUP entries that are not inheritable, are returned rather
+// than converted so that the caller can decide whether the loss is
+// acceptable. Without a mapping only Unix user and group SIDs can be
+// resolved, so every entry for a domain or well-known SID other than those
+// above is dropped.
+func FromSecurityDescriptor(sd *ntsecurity.SecurityDescriptor, ids idmap.Backend) (acl *ACL, dropped []ntsecurity.ACE) {
+	acl = new(ACL)
+	for _, m := range controlMapping {
+		if sd.Control.HasFlag(m.nt) {
+			acl.Flags |= m.nfs4
+		}
+	}
+	if sd.DACL == nil {
+		acl.Entries = append(acl.Entries, ACE{
+			Type:    AccessAllowedACEType,
+			Mask:    validAccessMask,
+			Special: Everyone,
+		})
+	}
+	for _, list := range []*ntsecurity.ACL{sd.DACL, sd.SACL} {
+		if list == nil {
+			continue
+		}
+		for _, ntACE := range list.Entries {
+			if ace, ok := fromNTACE(ntACE, ids); ok {
+				acl.Entries = append(acl.Entries, ace)
+			} else {
+				dropped = append(dropped, ntACE)
+			}
+		}
+	}
+	return
+}
+
+// fromNTACE converts an NT ACE into an NFSv4 ACE, or returns false if it
+// cannot be represented.
+func fromNTACE(ntACE ntsecurity.ACE, ids idmap.Backend) (ace ACE, ok bool) {
+	if ace.Type, ok = typeMapping[ntACE.Type]; !ok {
+		return
+	}
+	for _, m := range flagMapping {
+		if ntACE.Flags.HasFlag(m.nt) {
+			ace.Flags |= m.nfs4
+		}
+	}
+	ace.Mask = AccessMask(ntACE.Mask.MapGeneric(ntsecurity.FileGenericMapping)) & validAccessMask
+	inheritable := ace.Flags&(FileInheritACE|DirectoryInheritACE) != 0
+	switch {
+	case ntACE.SID.Equal(ntsecurity.WorldSID()):
+		ace.Special = Everyone
+	case ntACE.SID.Equal(ntsecurity.CreatorOwnerSID()):
+		ace.Special = Owner
+		ace.Flags |= InheritOnlyACE
+		ok = inheritable
+	case ntACE.SID.Equal(ntsecurity.CreatorGroupSID()):
+		ace.Special = Group
+		ace.Flags |= InheritOnlyACE
+		ok = inheritable
+	default:
+		typ, id, err := idmap.ResolveSID(ids, ntACE.SID)
+		if err != nil {
+			return ace, false
+		}
+		ace.ID = id
+		if typ == idmap.GroupID {
+			ace.Flags |= IdentifierGroup
+		}
+	}
+	return
+}
+
+// SecurityDescriptor converts the ACL into an NT security descriptor for a
+// file with the given owner and group SIDs. Audit and alarm entries make up
+// the SACL, and the other entries the DACL. Entries of unknown types or for
+// unknown special principals are left out.
+//
+// EVERYONE@ becomes Everyone. OWNER@ and GROUP@ become the owner and group
+// SIDs, except in entries that are only inherited, in which they become
+// CREATOR OWNER and CREATOR GROUP, as they do in Samba. An entry for them that
+// applies to the file and is inherited as well is split into an entry for
+// each. Users and groups become the SIDs that the mapping, which may be nil,
+// maps them to; see idmap.ResolveID.
+func (acl *ACL) SecurityDescriptor(owner, group ntsecurity.SID, ids idmap.Backend) *ntsecurity.SecurityDescriptor {
+	sd := &ntsecurity.SecurityDescriptor{
+		Revision: 1,
+		Control:  ntsecurity.SelfRelative | ntsecurity.DACLPresent,
+		Owner:    &owner,
+		Group:    &group,
+		DACL:     &ntsecurity.ACL{Revision: ntsecurity.MinACLRevision},
+	}
+	for _, m := range controlMapping {
+		if acl.Flags&m.nfs4 != 0 {
+			sd.Control |= m.nt
+		}
+	}
+	for _, ace := range acl.Entries {
+		list := sd.DACL
+		if ace.Type == SystemAuditACEType || ace.Type == SystemAlarmACEType {
+			if sd.SACL == nil {
+				sd.Control |= ntsecurity.SACLPresent
+				sd.SACL = &ntsecurity.ACL{Revision: ntsecurity.MinACLRevision}
+			}
+			list = sd.SACL
+		}
+		list.Entries = append(list.Entries, toNTACEs(ace, owner, group, ids)...)
+	}
+	return sd
+}
+
+// toNTACEs converts an NFSv4 ACE into the NT ACEs that it corresponds to.
+// Entries of unknown types or for unknown special principals have none.
+func toNTACEs(ace ACE, owner, group ntsecurity.SID, ids idmap.Backend) []ntsecurity.ACE {
+	ntACE := ntsecurity.ACE{Mask: ntsecurity.AccessMask(ace.Mask & validAccessMask)}
+	known := false
+	for t, nfs4 := range typeMapping {
+		if ace.Type == nfs4 {
+			ntACE.Type, known = t, true
+		}
+	}
+	if !known {
+		return nil
+	}
+	for _, m := range flagMapping {
+		if ace.Flags.HasFlag(m.nfs4) {
+			ntACE.Flags |= m.nt
+		}
+	}
+
+	var creator ntsecurity.SID
+	switch ace.Special {
+	case Owner:
+		ntACE.SID, creator = owner, ntsecurity.CreatorOwnerSID()
+	case Group:
+		ntACE.SID, creator = group, ntsecurity.CreatorGroupSID()
+	case Everyone:
+		ntACE.SID = ntsecurity.WorldSID()
+		return []ntsecurity.ACE{ntACE}
+	case NotSpecial:
+		typ := idmap.UserID
+		if ace.Flags.HasFlag(IdentifierGroup) {
+			typ = idmap.GroupID
+		}
+		ntACE.SID = idmap.ResolveID(ids, ace.ID, typ)
+		return []ntsecurity.ACE{ntACE}
+	default:
+		return nil
+	}
+
+	inheritFlags := ntsecurity.ObjectInheritFlag | ntsecurity.ContainerInheritFlag
+	if ntACE.Flags.HasFlag(ntsecurity.InheritOnlyFlag) {
+		ntACE.SID = creator
+		return []ntsecurity.ACE{ntACE}
+	}
+	if ntACE.Flags&inheritFlags == 0 {
+		return []ntsecurity.ACE{ntACE}
+	}
+	inherited := ntACE
+	inherited.SID = creator
+	inherited.Flags |= ntsecurity.InheritOnlyFlag
+	ntACE.Flags &^= inheritFlags | ntsecurity.NoPropagateInheritFlag
+	return []ntsecurity.ACE{ntACE, inherited}
+}
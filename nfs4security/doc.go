@@ -0,0 +1,14 @@
+/*
+Package nfs4security defines NFSv4 access control lists, encodes them in the
+extended attribute formats used to store them on Linux, and converts them to
+and from NT security descriptors.
+
+Three formats are supported: the XDR encoding of system.nfs4_acl that the
+Linux NFS client and nfs4-acl-tools use, which identifies users and groups by
+name, and the XDR and NDR encodings that Samba's vfs_nfs4acl_xattr stores in
+security.nfs4acl_xdr and security.nfs4acl, which identify them by ID.
+
+RichACL extends NFSv4 ACLs with the file masks of the richacl model and
+encodes them in the system.richacl format of richacl-patched Linux kernels.
+*/
+package nfs4security
@@ -0,0 +1,108 @@
+package nfs4security
+
+import (
+	"errors"
+
+	"go.scj.io/samba-over-ntfs/ndr"
+)
+
+// The versions of the NDR encoding of vfs_nfs4acl_xattr, which correspond to
+// NFSv4.0 and NFSv4.1 ACLs. Only the latter has ACL flags.
+const (
+	NDRVersion40 = 0
+	NDRVersion41 = 1
+)
+
+// ndrSpecialWho is the flag of an NDR entry whose ID is a special principal,
+// ACE4_SPECIAL_WHO of nfs4acl.idl. The e_who string of such an entry holds
+// the name of the principal, and that of other entries is empty. It differs
+// from the flag of richacls, which are a separate format.
+const ndrSpecialWho = 0x0100
+
+var errUnknownNDRVersion = errors.New("Unknown NFSv4 ACL NDR version")
+
+// MarshalNDR encodes the ACL in the NDR format in which vfs_nfs4acl_xattr
+// stores it, which is the nfs4acl structure of Samba's nfs4acl.idl, as an
+// NFSv4.1 ACL. Each entry ends with its e_who string, which is a null
+// terminated utf8string.
+func (acl *ACL) MarshalNDR() ([]byte, error) {
+	if len(acl.Entries) > 0xffff {
+		return nil, errors.New("Too many entries for an NFSv4 ACL NDR encoding")
+	}
+	e := ndr.NewEncoder()
+	e.Uint8(NDRVersion41)
+	e.Uint8(uint8(acl.Flags))
+	e.Uint16(uint16(len(acl.Entries)))
+	for _, ace := range acl.Entries {
+		e.Align(4)
+		flags := uint16(ace.Flags)
+		id := ace.ID
+		var who string
+		if ace.Special != NotSpecial {
+			name, ok := specialNames[ace.Special]
+			if !ok {
+				return nil, errUnknownSpecial
+			}
+			flags |= ndrSpecialWho
+			id = uint32(ace.Special)
+			who = name
+		}
+		e.Uint16(uint16(ace.Type))
+		e.Uint16(flags)
+		e.Uint32(uint32(ace.Mask))
+		e.Uint32(id)
+		e.NullTermString(who)
+	}
+	return e.Bytes(), nil
+}
+
+// UnmarshalNDR decodes an ACL from the NDR format in which
+// vfs_nfs4acl_xattr stores it. The flags of NFSv4.0 ACLs are ignored. A
+// special principal is identified by its e_who name, or by its ID if the
+// name is not known.
+func (acl *ACL) UnmarshalNDR(data []byte) error {
+	d := ndr.NewDecoder(data)
+	version := d.Uint8()
+	flags := ACLFlag(d.Uint8())
+	count := d.Uint16()
+	if d.Err() != nil {
+		return d.Err()
+	}
+	switch version {
+	case NDRVersion40:
+		flags = 0
+	case NDRVersion41:
+	default:
+		return errUnknownNDRVersion
+	}
+	if int(count)*13 > len(data) {
+		return ndr.ErrTruncated
+	}
+	entries := make([]ACE, count)
+	for i := range entries {
+		ace := &entries[i]
+		d.Align(4)
+		ace.Type = ACEType(d.Uint16())
+		aceFlags := d.Uint16()
+		ace.Mask = AccessMask(d.Uint32())
+		id := d.Uint32()
+		who := d.NullTermString()
+		ace.Flags = ACEFlag(aceFlags &^ ndrSpecialWho)
+		if aceFlags&ndrSpecialWho == 0 {
+			ace.ID = id
+			continue
+		}
+		ace.Special = SpecialWho(id)
+		for special, name := range specialNames {
+			if who == name {
+				ace.Special = special
+			}
+		}
+	}
+	if d.Err() != nil {
+		return d.Err()
+	}
+	acl.Flags = flags
+	acl.Entries = entries
+	return nil
+}
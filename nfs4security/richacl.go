@@ -0,0 +1,286 @@
+package nfs4security
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"go.scj.io/samba-over-ntfs/idmap"
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// RichACLXAttrName is the extended attribute in which richacl-patched Linux
+// kernels store richacls.
+const RichACLXAttrName = "system.richacl"
+
+// richACLVersion is the only version of the system.richacl format.
+const richACLVersion = 0
+
+// The lengths of the header and the entries of the system.richacl format.
+const (
+	richACLHeaderLength = 16
+	richACELength       = 12
+)
+
+// The flags of system.richacl entries that have no NFSv4 counterpart.
+const (
+	richACEUnmappedWho = 0x2000
+	richACESpecialWho  = 0x4000
+)
+
+// The flags that richacl entries may carry.
+const richACEFlags = FileInheritACE | DirectoryInheritACE | NoPropagateInheritACE |
+	InheritOnlyACE | IdentifierGroup | InheritedACE
+
+var (
+	errRichACLVersion  = errors.New("Unsupported richacl version")
+	errRichACLType     = errors.New("Richacls only have allow and deny entries")
+	errRichACLUnmapped = errors.New("Richacl entries with unmapped principals are not supported")
+)
+
+// RichACL is a richacl, which is an NFSv4 ACL combined with file masks. When
+// the MaskedACL flag is set, the owner mask limits the permissions that the
+// entries grant to the owner, the other mask limits those granted to everyone
+// who is neither the owner nor matched by an entry for GROUP@, a user or a
+// group, and the group mask limits those granted to everyone else. With the
+// WriteThroughACL flag, the owner and others are granted exactly the
+// permissions of their masks. Entries that are only inherited are never
+// masked.
+type RichACL struct {
+	ACL
+	OwnerMask AccessMask
+	GroupMask AccessMask
+	OtherMask AccessMask
+}
+
+// NewRichACL returns a richacl with the entries and flags of the ACL, whose
+// masks are the largest permissions that the entries may grant to each class,
+// as computed by richacl_compute_max_masks, so that they do not limit the
+// entries. The MaskedACL flag is not set.
+func NewRichACL(acl *ACL) *RichACL {
+	r := &RichACL{ACL: ACL{Flags: acl.Flags &^ (WriteThroughACL | MaskedACL), Entries: acl.Entries}}
+	var ownerDenied, groupDenied, otherDenied AccessMask
+	for _, ace := range acl.Entries {
+		if ace.Flags.HasFlag(InheritOnlyACE) {
+			continue
+		}
+		// Only the denials that apply to every member of a class bound its
+		// permissions, but any allowed permission may apply to some member
+		switch ace.Type {
+		case AccessDeniedACEType:
+			switch ace.Special {
+			case Everyone:
+				ownerDenied |= ace.Mask &^ r.OwnerMask
+				groupDenied |= ace.Mask &^ r.GroupMask
+				otherDenied |= ace.Mask &^ r.OtherMask
+			case Owner:
+				ownerDenied |= ace.Mask &^ r.OwnerMask
+			}
+		case AccessAllowedACEType:
+			switch ace.Special {
+			case Everyone:
+				r.OwnerMask |= ace.Mask &^ ownerDenied
+				r.GroupMask |= ace.Mask &^ groupDenied
+				r.OtherMask |= ace.Mask &^ otherDenied
+			case Owner:
+				r.OwnerMask |= ace.Mask &^ ownerDenied
+			default:
+				// The owner may be a member of the group class as well
+				r.OwnerMask |= ace.Mask &^ ownerDenied
+				r.GroupMask |= ace.Mask &^ groupDenied
+			}
+		}
+	}
+	return r
+}
+
+// RichACLFromSecurityDescriptor converts the DACL of the security descriptor
+// into a richacl as FromSecurityDescriptor converts it into an NFSv4 ACL, and
+// computes masks that do not limit it. The SACL is not converted, since
+// richacls have no audit entries.
+func RichACLFromSecurityDescriptor(sd *ntsecurity.SecurityDescriptor, ids idmap.Backend) (acl *RichACL, dropped []ntsecurity.ACE) {
+	dacl := *sd
+	dacl.SACL = nil
+	nfs4, dropped := FromSecurityDescriptor(&dacl, ids)
+	return NewRichACL(nfs4), dropped
+}
+
+// UpdateSecurityDescriptor returns the security descriptor that results from
+// replacing the DACL of sd with the richacl, which is converted as by
+// SecurityDescriptor for the owner and group of sd, both of which must be
+// set. The control flags and SACL of sd are kept, and so are the entries of
+// its DACL that RichACLFromSecurityDescriptor leaves out, since the richacl
+// cannot represent them. Each of those is placed after the converted entries
+// that precede it in the canonical order of explicit deny, explicit allow,
+// inherited deny and inherited allow entries.
+func (acl *RichACL) UpdateSecurityDescriptor(sd *ntsecurity.SecurityDescriptor, ids idmap.Backend) *ntsecurity.SecurityDescriptor {
+	_, dropped := RichACLFromSecurityDescriptor(sd, ids)
+	updated := acl.SecurityDescriptor(*sd.Owner, *sd.Group, ids)
+	updated.Control |= sd.Control & (ntsecurity.SACLPresent | ntsecurity.SACLAutoInherited | ntsecurity.SACLProtected)
+	updated.SACL = sd.SACL
+	for _, ace := range dropped {
+		entries := updated.DACL.Entries
+		i := len(entries)
+		for i > 0 && canonicalOrder(entries[i-1]) > canonicalOrder(ace) {
+			i--
+		}
+		entries = append(entries, ntsecurity.ACE{})
+		copy(entries[i+1:], entries[i:])
+		entries[i] = ace
+		updated.DACL.Entries = entries
+	}
+	return updated
+}
+
+// canonicalOrder returns the position of the group of DACL entries that the
+// entry belongs to in the canonical order.
+func canonicalOrder(ace ntsecurity.ACE) int {
+	order := 1
+	if ace.Type == ntsecurity.AccessDeniedControl || ace.Type == ntsecurity.AccessDeniedObjectControl {
+		order = 0
+	}
+	if ace.Flags.HasFlag(ntsecurity.InheritedFlag) {
+		order += 2
+	}
+	return order
+}
+
+// Unmasked returns an NFSv4 ACL that grants no more than the richacl. If the
+// MaskedACL flag is set, the masks are applied to the allow entries: entries
+// for OWNER@ are limited by the owner mask, those for GROUP@, users and
+// groups by the group mask, and those for EVERYONE@ by the other mask, with
+// additional entries granting OWNER@ and GROUP@ what their masks allow beyond
+// it. Entries that the masks leave without permissions are left out, and an
+// entry that is also inherited keeps its permissions in a separate entry that
+// is only inherited. Users and groups that are granted permissions by
+// EVERYONE@ only are limited by the other mask, and the WriteThroughACL flag
+// is ignored, so the ACL may grant less than the richacl but never more.
+func (acl *RichACL) Unmasked() *ACL {
+	flags := acl.Flags &^ (WriteThroughACL | MaskedACL)
+	if acl.Flags&MaskedACL == 0 {
+		return &ACL{Flags: flags, Entries: acl.Entries}
+	}
+	unmasked := &ACL{Flags: flags}
+	for _, ace := range acl.Entries {
+		if ace.Type != AccessAllowedACEType || ace.Flags.HasFlag(InheritOnlyACE) {
+			unmasked.Entries = append(unmasked.Entries, ace)
+			continue
+		}
+		if ace.Flags&(FileInheritACE|DirectoryInheritACE) != 0 {
+			inherited := ace
+			inherited.Flags |= InheritOnlyACE
+			unmasked.Entries = append(unmasked.Entries, inherited)
+			ace.Flags &^= FileInheritACE | DirectoryInheritACE | NoPropagateInheritACE
+		}
+		switch ace.Special {
+		case Owner:
+			ace.Mask &= acl.OwnerMask
+		case Everyone:
+			mask := ace.Mask
+			ace.Mask &= acl.OtherMask
+			for _, extra := range []struct {
+				who  SpecialWho
+				mask AccessMask
+			}{{Owner, acl.OwnerMask}, {Group, acl.GroupMask}} {
+				if m := mask & extra.mask &^ acl.OtherMask; m != 0 {
+					unmasked.Entries = append(unmasked.Entries, ACE{
+						Type:    AccessAllowedACEType,
+						Flags:   ace.Flags &^ IdentifierGroup,
+						Mask:    m,
+						Special: extra.who,
+					})
+				}
+			}
+		default:
+			ace.Mask &= acl.GroupMask
+		}
+		if ace.Mask != 0 {
+			unmasked.Entries = append(unmasked.Entries, ace)
+		}
+	}
+	return unmasked
+}
+
+// SecurityDescriptor converts the richacl into an NT security descriptor for
+// a file with the given owner and group SIDs, as ACL.SecurityDescriptor
+// converts the ACL returned by Unmasked.
+func (acl *RichACL) SecurityDescriptor(owner, group ntsecurity.SID, ids idmap.Backend) *ntsecurity.SecurityDescriptor {
+	return acl.Unmasked().SecurityDescriptor(owner, group, ids)
+}
+
+// MarshalBinary encodes the richacl in the system.richacl format. Audit and
+// alarm entries cannot be encoded, and the audit flags of entries are left
+// out.
+func (acl *RichACL) MarshalBinary() ([]byte, error) {
+	if len(acl.Entries) > 0xffff {
+		return nil, errors.New("Too many entries for a richacl")
+	}
+	data := make([]byte, richACLHeaderLength+len(acl.Entries)*richACELength)
+	data[0] = richACLVersion
+	data[1] = uint8(acl.Flags)
+	binary.LittleEndian.PutUint16(data[2:4], uint16(len(acl.Entries)))
+	binary.LittleEndian.PutUint32(data[4:8], uint32(acl.OwnerMask))
+	binary.LittleEndian.PutUint32(data[8:12], uint32(acl.GroupMask))
+	binary.LittleEndian.PutUint32(data[12:16], uint32(acl.OtherMask))
+	for i, ace := range acl.Entries {
+		if ace.Type != AccessAllowedACEType && ace.Type != AccessDeniedACEType {
+			return nil, errRichACLType
+		}
+		flags := uint16(ace.Flags & richACEFlags)
+		id := ace.ID
+		if ace.Special != NotSpecial {
+			// The special IDs of richacls count from zero
+			flags |= richACESpecialWho
+			id = uint32(ace.Special) - 1
+		}
+		b := data[richACLHeaderLength+i*richACELength:]
+		binary.LittleEndian.PutUint16(b[0:2], uint16(ace.Type))
+		binary.LittleEndian.PutUint16(b[2:4], flags)
+		binary.LittleEndian.PutUint32(b[4:8], uint32(ace.Mask))
+		binary.LittleEndian.PutUint32(b[8:12], id)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a richacl from the system.richacl format.
+func (acl *RichACL) UnmarshalBinary(data []byte) error {
+	if len(data) < richACLHeaderLength {
+		return errTruncated
+	}
+	if data[0] != richACLVersion {
+		return errRichACLVersion
+	}
+	count := int(binary.LittleEndian.Uint16(data[2:4]))
+	if len(data) < richACLHeaderLength+count*richACELength {
+		return errTruncated
+	}
+	entries := make([]ACE, count)
+	for i := range entries {
+		b := data[richACLHeaderLength+i*richACELength:]
+		ace := &entries[i]
+		ace.Type = ACEType(binary.LittleEndian.Uint16(b[0:2]))
+		if ace.Type != AccessAllowedACEType && ace.Type != AccessDeniedACEType {
+			return errRichACLType
+		}
+		flags := binary.LittleEndian.Uint16(b[2:4])
+		if flags&richACEUnmappedWho != 0 {
+			return errRichACLUnmapped
+		}
+		ace.Flags = ACEFlag(flags) & richACEFlags
+		ace.Mask = AccessMask(binary.LittleEndian.Uint32(b[4:8]))
+		id := binary.LittleEndian.Uint32(b[8:12])
+		if flags&richACESpecialWho != 0 {
+			ace.Special = SpecialWho(id + 1)
+			if ace.Special > Everyone {
+				return errUnknownSpecial
+			}
+		} else {
+			ace.ID = id
+		}
+	}
+	acl.Flags = ACLFlag(data[1])
+	acl.Entries = entries
+	acl.OwnerMask = AccessMask(binary.LittleEndian.Uint32(data[4:8]))
+	acl.GroupMask = AccessMask(binary.LittleEndian.Uint32(data[8:12]))
+	acl.OtherMask = AccessMask(binary.LittleEndian.Uint32(data[12:16]))
+	return nil
+}
@@ -0,0 +1,63 @@
+package nfs4security
+
+import (
+	"testing"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// TestRichACLRoundTrip checks that writing back the richacl of a security
+// descriptor keeps the entries that the richacl cannot represent: an object
+// entry, an entry for a SID that is not mapped and a CREATOR OWNER entry that
+// is not inheritable.
+func TestRichACLRoundTrip(t *testing.T) {
+	owner := ntsecurity.MustParseSID("S-1-22-1-1000")
+	group := ntsecurity.MustParseSID("S-1-22-2-100")
+	unmapped := ntsecurity.MustParseSID("S-1-5-21-1004336348-1177238915-682003330-1104")
+	sd := &ntsecurity.SecurityDescriptor{
+		Revision: 1,
+		Control:  ntsecurity.SelfRelative | ntsecurity.DACLPresent,
+		Owner:    &owner,
+		Group:    &group,
+		DACL: &ntsecurity.ACL{Revision: ntsecurity.MinACLRevision, Entries: []ntsecurity.ACE{
+			{Type: ntsecurity.AccessDeniedControl, Mask: 0x00000002, SID: ntsecurity.MustParseSID("S-1-22-1-1001")},
+			{Type: ntsecurity.AccessDeniedObjectControl, Mask: 0x00000100, SID: owner,
+				ObjectFlags: ntsecurity.ObjectTypePresent, ObjectType: ntsecurity.GUID{1, 2, 3, 4}},
+			{Type: ntsecurity.AccessAllowedControl, Mask: 0x001f01ff, SID: owner},
+			{Type: ntsecurity.AccessAllowedControl, Mask: 0x001200a9, SID: group},
+			{Type: ntsecurity.AccessAllowedControl, Mask: 0x001200a9, SID: ntsecurity.WorldSID()},
+			{Type: ntsecurity.AccessAllowedControl, Mask: 0x001301bf, SID: unmapped},
+			{Type: ntsecurity.AccessAllowedControl, Mask: 0x001200a9, SID: ntsecurity.CreatorOwnerSID()},
+			{Type: ntsecurity.AccessAllowedControl, Flags: ntsecurity.InheritedFlag, Mask: 0x001200a9, SID: ntsecurity.MustParseSID("S-1-22-2-101")},
+		}},
+	}
+	want := sd.SDDL()
+
+	acl, dropped := RichACLFromSecurityDescriptor(sd, nil)
+	if len(dropped) != 3 {
+		t.Fatalf("Left out %d entries, want 3", len(dropped))
+	}
+	data, err := acl.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded RichACL
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded.UpdateSecurityDescriptor(sd, nil).SDDL(); got != want {
+		t.Errorf("Round trip produced\n%s\nwant\n%s", got, want)
+	}
+
+	// Entries written in place of the representable ones are ordered around
+	// those that are kept
+	decoded.Entries = append([]ACE{{Type: AccessDeniedACEType, Mask: WriteData, ID: 1002}}, decoded.Entries[1:]...)
+	updated := decoded.UpdateSecurityDescriptor(sd, nil)
+	entries := updated.DACL.Entries
+	if len(entries) != len(sd.DACL.Entries) {
+		t.Fatalf("Updated DACL has %d entries, want %d", len(entries), len(sd.DACL.Entries))
+	}
+	if !entries[0].SID.Equal(ntsecurity.MustParseSID("S-1-22-1-1002")) || entries[1].Type != ntsecurity.AccessDeniedObjectControl {
+		t.Errorf("Updated DACL starts with %s %s", entries[0].SDDL(), entries[1].SDDL())
+	}
+}
@@ -0,0 +1,229 @@
+package nfs4security
+
+import (
+	"encoding/binary"
+	"errors"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+var (
+	errTruncated        = errors.New("NFSv4 ACL data has been corrupted or truncated")
+	errUnknownPrincipal = errors.New("Unknown NFSv4 ACL principal")
+	errUnknownSpecial   = errors.New("Unknown NFSv4 ACL special principal")
+)
+
+// specialWhoFlag is the iflag of a Samba XDR entry whose who member holds a
+// special principal rather than an ID.
+const specialWhoFlag = 0x00000001
+
+// MarshalNFS encodes the ACL in the XDR format of system.nfs4_acl, which is
+// the nfsace4 array of the NFSv4 protocol. Users and groups are identified by
+// their IDs in decimal, as the Linux NFS client identifies them when ID
+// mapping is disabled. The flags of the ACL are not encoded.
+func (acl *ACL) MarshalNFS() ([]byte, error) {
+	var e xdrEncoder
+	e.uint32(uint32(len(acl.Entries)))
+	for _, ace := range acl.Entries {
+		e.uint32(uint32(ace.Type))
+		e.uint32(uint32(ace.Flags))
+		e.uint32(uint32(ace.Mask))
+		if ace.Special != NotSpecial {
+			name, ok := specialNames[ace.Special]
+			if !ok {
+				return nil, errUnknownSpecial
+			}
+			e.string(name)
+		} else {
+			e.string(strconv.FormatUint(uint64(ace.ID), 10))
+		}
+	}
+	return e.data, nil
+}
+
+// UnmarshalNFS decodes an ACL from the XDR format of system.nfs4_acl. A
+// principal that is not a decimal ID is looked up as the name of a user or
+// group, ignoring the domain that follows an @, and an error is returned if
+// there is no such user or group.
+func (acl *ACL) UnmarshalNFS(data []byte) error {
+	d := xdrDecoder{data: data}
+	count := d.uint32()
+	if uint64(count)*16 > uint64(len(data)) {
+		return errTruncated
+	}
+	entries := make([]ACE, count)
+	for i := range entries {
+		ace := &entries[i]
+		ace.Type = ACEType(d.uint32())
+		ace.Flags = ACEFlag(d.uint32())
+		ace.Mask = AccessMask(d.uint32())
+		who := d.string()
+		if d.err != nil {
+			return d.err
+		}
+		var err error
+		if ace.Special, ace.ID, err = parseWho(who, ace.Flags.HasFlag(IdentifierGroup)); err != nil {
+			return err
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	acl.Flags = 0
+	acl.Entries = entries
+	return nil
+}
+
+// MarshalXDR encodes the ACL in the XDR format in which vfs_nfs4acl_xattr
+// stores it, which is the nfsacl41i structure of Samba's nfs41acl.x. Each
+// nfsace4i entry holds its type, flag, iflag, access_mask and who in that
+// order, the who member being an ID or a special principal.
+func (acl *ACL) MarshalXDR() ([]byte, error) {
+	var e xdrEncoder
+	e.uint32(uint32(acl.Flags))
+	e.uint32(uint32(len(acl.Entries)))
+	for _, ace := range acl.Entries {
+		e.uint32(uint32(ace.Type))
+		e.uint32(uint32(ace.Flags))
+		if ace.Special != NotSpecial {
+			e.uint32(specialWhoFlag)
+			e.uint32(uint32(ace.Mask))
+			e.uint32(uint32(ace.Special))
+		} else {
+			e.uint32(0)
+			e.uint32(uint32(ace.Mask))
+			e.uint32(ace.ID)
+		}
+	}
+	return e.data, nil
+}
+
+// UnmarshalXDR decodes an ACL from the XDR format in which vfs_nfs4acl_xattr
+// stores it.
+func (acl *ACL) UnmarshalXDR(data []byte) error {
+	d := xdrDecoder{data: data}
+	flags := ACLFlag(d.uint32())
+	count := d.uint32()
+	if uint64(count)*20 > uint64(len(data)) {
+		return errTruncated
+	}
+	entries := make([]ACE, count)
+	for i := range entries {
+		ace := &entries[i]
+		ace.Type = ACEType(d.uint32())
+		ace.Flags = ACEFlag(d.uint32())
+		iflag := d.uint32()
+		ace.Mask = AccessMask(d.uint32())
+		who := d.uint32()
+		if iflag&specialWhoFlag != 0 {
+			ace.Special = SpecialWho(who)
+		} else {
+			ace.ID = who
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	acl.Flags = flags
+	acl.Entries = entries
+	return nil
+}
+
+// parseWho returns the principal identified by a who string of
+// system.nfs4_acl.
+func parseWho(who string, group bool) (SpecialWho, uint32, error) {
+	for special, name := range specialNames {
+		if who == name {
+			return special, 0, nil
+		}
+	}
+	if id, err := strconv.ParseUint(who, 10, 32); err == nil {
+		return NotSpecial, uint32(id), nil
+	}
+	name := who
+	if i := strings.LastIndexByte(name, '@'); i >= 0 {
+		name = name[:i]
+	}
+	var id string
+	if group {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return 0, 0, errUnknownPrincipal
+		}
+		id = g.Gid
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return 0, 0, errUnknownPrincipal
+		}
+		id = u.Uid
+	}
+	v, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, 0, errUnknownPrincipal
+	}
+	return NotSpecial, uint32(v), nil
+}
+
+// xdrEncoder writes XDR encoded data, which is big-endian and padded to
+// multiples of four bytes.
+type xdrEncoder struct {
+	data []byte
+}
+
+func (e *xdrEncoder) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.data = append(e.data, b[:]...)
+}
+
+func (e *xdrEncoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.data = append(e.data, s...)
+	for len(e.data)%4 != 0 {
+		e.data = append(e.data, 0)
+	}
+}
+
+// xdrDecoder reads XDR encoded data. Errors are sticky, as in the ndr
+// package.
+type xdrDecoder struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (d *xdrDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.offset+n > len(d.data) {
+		d.err = errTruncated
+		return nil
+	}
+	b := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return b
+}
+
+func (d *xdrDecoder) uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *xdrDecoder) string() string {
+	n := d.uint32()
+	if uint64(n) > uint64(len(d.data)) {
+		d.err = errTruncated
+		return ""
+	}
+	b := d.next(int(n+3) &^ 3)
+	if b == nil {
+		return ""
+	}
+	return string(b[:n])
+}
@@ -0,0 +1,13 @@
+package nfs4security
+
+import "testing"
+
+func TestXDRRoundTrip(t *testing.T) {
+	testRoundTrip(t, "testdata/nfs4acl.xdr", fixtureACL, (*ACL).UnmarshalXDR, (*ACL).MarshalXDR)
+}
+
+func TestNFSRoundTrip(t *testing.T) {
+	// system.nfs4_acl does not carry the flags of the ACL
+	want := ACL{Entries: fixtureACL.Entries}
+	testRoundTrip(t, "testdata/nfs4_acl.xdr", want, (*ACL).UnmarshalNFS, (*ACL).MarshalNFS)
+}
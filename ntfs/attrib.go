@@ -0,0 +1,65 @@
+package ntfs
+
+import "errors"
+
+const (
+	// FileAttributesName is the name of the extended attribute through which
+	// the ntfs-3g file system driver exposes the NTFS file attributes of a
+	// file. The value is a 32-bit integer in the byte order of the host.
+	FileAttributesName = "system.ntfs_attrib"
+
+	// CreationTimeName is the name of the extended attribute through which the
+	// ntfs-3g file system driver exposes the NTFS creation time of a file. The
+	// value is a 64-bit integer in the byte order of the host.
+	CreationTimeName = "system.ntfs_crtime"
+
+	// TimesName is the name of the extended attribute through which the
+	// ntfs-3g file system driver exposes all four NTFS timestamps of a file.
+	// The value is a sequence of four 64-bit integers in the byte order of the
+	// host.
+	TimesName = "system.ntfs_times"
+)
+
+// FileAttributes stores the NTFS file attribute flags of a file.
+type FileAttributes uint32
+
+const (
+	ReadOnlyAttribute          FileAttributes = 0x00000001
+	HiddenAttribute            FileAttributes = 0x00000002
+	SystemAttribute            FileAttributes = 0x00000004
+	DirectoryAttribute         FileAttributes = 0x00000010
+	ArchiveAttribute           FileAttributes = 0x00000020
+	DeviceAttribute            FileAttributes = 0x00000040
+	NormalAttribute            FileAttributes = 0x00000080
+	TemporaryAttribute         FileAttributes = 0x00000100
+	SparseFileAttribute        FileAttributes = 0x00000200
+	ReparsePointAttribute      FileAttributes = 0x00000400
+	CompressedAttribute        FileAttributes = 0x00000800
+	OfflineAttribute           FileAttributes = 0x00001000
+	NotContentIndexedAttribute FileAttributes = 0x00002000
+	EncryptedAttribute         FileAttributes = 0x00004000
+)
+
+// HasFlag returns true if the file attributes contain the given flag,
+// otherwise it returns false.
+func (a FileAttributes) HasFlag(flag FileAttributes) bool {
+	return a&flag == flag
+}
+
+// MarshalBinary writes the file attributes in the format used by the
+// system.ntfs_attrib extended attribute.
+func (a FileAttributes) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 4)
+	nativeEndian.PutUint32(data, uint32(a))
+	return
+}
+
+// UnmarshalBinary reads file attributes from a byte slice containing
+// system.ntfs_attrib extended attribute data.
+func (a *FileAttributes) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return errors.New("NTFS file attribute data has an invalid length")
+	}
+	*a = FileAttributes(nativeEndian.Uint32(data))
+	return nil
+}
@@ -0,0 +1,72 @@
+package ntfs
+
+import (
+	"errors"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// The names of the extended attributes through which the Linux CIFS client
+// (cifs.ko) exposes the security descriptors of files on SMB shares, in the
+// same format as AttributeName. Each reads and writes a different part of
+// the descriptor. Newer kernels also accept the smb3 names, which are
+// aliases of the cifs ones.
+const (
+	// CIFSACLName reads the owner, group and DACL, and writes the DACL.
+	CIFSACLName = "system.cifs_acl"
+
+	// CIFSNTSDName reads and writes the owner, group and DACL.
+	CIFSNTSDName = "system.cifs_ntsd"
+
+	// CIFSNTSDFullName reads and writes the owner, group, DACL and SACL.
+	// Reading or writing the SACL requires the SeSecurityPrivilege on the
+	// server.
+	CIFSNTSDFullName = "system.cifs_ntsd_full"
+
+	SMB3ACLName      = "system.smb3_acl"
+	SMB3NTSDName     = "system.smb3_ntsd"
+	SMB3NTSDFullName = "system.smb3_ntsd_full"
+)
+
+var errNoSecurityInformation = errors.New("Security information must include the owner, group, DACL or SACL")
+
+// CIFSAttributeName returns the name of the CIFS client attribute that reads
+// or writes at least the parts of the security descriptor given by the
+// security information, and as few others as possible.
+func CIFSAttributeName(info ntsecurity.SecurityInformation, write bool) (string, error) {
+	all := ntsecurity.OwnerSecurityInformation | ntsecurity.GroupSecurityInformation |
+		ntsecurity.DACLSecurityInformation | ntsecurity.SACLSecurityInformation
+	switch {
+	case info&all == 0:
+		return "", errNoSecurityInformation
+	case info&ntsecurity.SACLSecurityInformation != 0:
+		return CIFSNTSDFullName, nil
+	case write && info&(ntsecurity.OwnerSecurityInformation|ntsecurity.GroupSecurityInformation) != 0:
+		return CIFSNTSDName, nil
+	default:
+		return CIFSACLName, nil
+	}
+}
+
+// ReadCIFSRawSD will return the raw security descriptor bytes of a file on
+// a share mounted by the CIFS client, including at least the parts given by
+// the security information.
+func ReadCIFSRawSD(path string, info ntsecurity.SecurityInformation) ([]byte, error) {
+	name, err := CIFSAttributeName(info, false)
+	if err != nil {
+		return nil, err
+	}
+	return ReadFileAttribute(path, name)
+}
+
+// WriteCIFSRawSD will write the parts of the given security descriptor bytes
+// that the security information specifies to a file on a share mounted by
+// the CIFS client. The DACL is always written, since the client offers no
+// way of writing the other parts without it.
+func WriteCIFSRawSD(path string, data []byte, info ntsecurity.SecurityInformation) error {
+	name, err := CIFSAttributeName(info, true)
+	if err != nil {
+		return err
+	}
+	return WriteFileAttribute(path, name, data)
+}
@@ -10,7 +10,9 @@ that the wire format is used in places other than the NTFS it may be
 appropriate to rename this package.
 
 File security descriptor access is currently possible on Linux build targets
-through the use of the ntfs-3g libary.
+through the use of the ntfs-3g libary, and for files on SMB shares through the
+extended attributes of the Linux CIFS client, which exposes descriptors in the
+same format.
 
 File security descriptor access on Windows build targets is currently under
 investigation.
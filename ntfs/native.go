@@ -0,0 +1,19 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// nativeEndian is the byte order of the host. The ntfs-3g file system driver
+// uses it for the integers it exposes through extended attributes other than
+// system.ntfs_acl.
+var nativeEndian = hostByteOrder()
+
+func hostByteOrder() binary.ByteOrder {
+	var x uint16 = 1
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
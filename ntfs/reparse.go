@@ -0,0 +1,177 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+const (
+	// ReparseDataName is the name of the extended attribute through which the
+	// ntfs-3g file system driver exposes the reparse point data of a file. The
+	// value is the REPARSE_DATA_BUFFER stored on disk.
+	ReparseDataName = "system.ntfs_reparse_data"
+
+	reparseHeaderFixedBytes = 4 + 2 + 2
+)
+
+// ReparseTag identifies the type of a reparse point and the file system filter
+// responsible for it.
+type ReparseTag uint32
+
+const (
+	ReparseTagMountPoint ReparseTag = 0xA0000003
+	ReparseTagSymlink    ReparseTag = 0xA000000C
+	ReparseTagDedup      ReparseTag = 0x80000013
+	ReparseTagNFS        ReparseTag = 0x80000014
+	ReparseTagWOF        ReparseTag = 0x80000017
+	ReparseTagLXSymlink  ReparseTag = 0xA000001D
+	ReparseTagAFUnix     ReparseTag = 0x80000023
+	ReparseTagLXFIFO     ReparseTag = 0x80000024
+	ReparseTagLXCharDev  ReparseTag = 0x80000025
+	ReparseTagLXBlockDev ReparseTag = 0x80000026
+)
+
+// IsMicrosoft returns true if the tag is owned by Microsoft.
+func (t ReparseTag) IsMicrosoft() bool { return t&0x80000000 != 0 }
+
+// IsNameSurrogate returns true if the reparse point refers to another named
+// entity, as symbolic links and mount points do.
+func (t ReparseTag) IsNameSurrogate() bool { return t&0x20000000 != 0 }
+
+// String returns a readable name for the tag.
+func (t ReparseTag) String() string {
+	switch t {
+	case ReparseTagMountPoint:
+		return "mount point"
+	case ReparseTagSymlink:
+		return "symbolic link"
+	case ReparseTagDedup:
+		return "deduplicated file"
+	case ReparseTagNFS:
+		return "NFS special file"
+	case ReparseTagWOF:
+		return "WOF compressed file"
+	case ReparseTagLXSymlink:
+		return "LX symbolic link"
+	case ReparseTagAFUnix:
+		return "AF_UNIX socket"
+	case ReparseTagLXFIFO:
+		return "LX FIFO"
+	case ReparseTagLXCharDev:
+		return "LX character device"
+	case ReparseTagLXBlockDev:
+		return "LX block device"
+	default:
+		return fmt.Sprintf("reparse tag 0x%08X", uint32(t))
+	}
+}
+
+// SymlinkFlags modify the interpretation of a symbolic link reparse point.
+type SymlinkFlags uint32
+
+const (
+	// SymlinkRelative indicates that the substitute name of a symbolic link is
+	// relative to the directory containing the link.
+	SymlinkRelative SymlinkFlags = 0x00000001
+)
+
+// HasFlag returns true if the symbolic link flags contain the given flag,
+// otherwise it returns false.
+func (f SymlinkFlags) HasFlag(flag SymlinkFlags) bool {
+	return f&flag == flag
+}
+
+// ReparsePoint is the decoded form of an NTFS reparse point.
+//
+// The substitute and print names are only populated for symbolic links,
+// mount points and LX symbolic links. The WOF members are only populated for
+// WOF compressed files.
+type ReparsePoint struct {
+	Tag ReparseTag
+
+	// SubstituteName is the path that the reparse point refers to, in the form
+	// used by the Windows object manager, such as \??\C:\Windows. LX symbolic
+	// links store a POSIX path here instead.
+	SubstituteName string
+
+	// PrintName is the path that should be presented to the user.
+	PrintName string
+
+	// Flags modify the interpretation of symbolic links.
+	Flags SymlinkFlags
+
+	// WOFVersion and WOFProvider identify the provider of a WOF compressed
+	// file.
+	WOFVersion  uint32
+	WOFProvider uint32
+
+	// Data holds the tag-specific data that follows the reparse point header.
+	Data []byte
+}
+
+// UnmarshalBinary reads a reparse point from a byte slice containing reparse
+// data formatted according to an NTFS data layout.
+func (rp *ReparsePoint) UnmarshalBinary(data []byte) (err error) {
+	corrupt := errors.New("Reparse point data has been corrupted or truncated")
+	if len(data) < reparseHeaderFixedBytes {
+		return corrupt
+	}
+	tag := ReparseTag(binary.LittleEndian.Uint32(data[0:4]))
+	length := int(binary.LittleEndian.Uint16(data[4:6]))
+	if reparseHeaderFixedBytes+length > len(data) {
+		return corrupt
+	}
+	*rp = ReparsePoint{Tag: tag}
+	rp.Data = make([]byte, length)
+	copy(rp.Data, data[reparseHeaderFixedBytes:reparseHeaderFixedBytes+length])
+
+	b := rp.Data
+	switch tag {
+	case ReparseTagSymlink, ReparseTagMountPoint:
+		fixed := 8
+		if tag == ReparseTagSymlink {
+			fixed += 4
+		}
+		if len(b) < fixed {
+			return corrupt
+		}
+		subOffset := int(binary.LittleEndian.Uint16(b[0:2]))
+		subLength := int(binary.LittleEndian.Uint16(b[2:4]))
+		printOffset := int(binary.LittleEndian.Uint16(b[4:6]))
+		printLength := int(binary.LittleEndian.Uint16(b[6:8]))
+		if tag == ReparseTagSymlink {
+			rp.Flags = SymlinkFlags(binary.LittleEndian.Uint32(b[8:12]))
+		}
+		path := b[fixed:]
+		if subOffset+subLength > len(path) || printOffset+printLength > len(path) {
+			return corrupt
+		}
+		rp.SubstituteName = decodeUTF16(path[subOffset : subOffset+subLength])
+		rp.PrintName = decodeUTF16(path[printOffset : printOffset+printLength])
+	case ReparseTagLXSymlink:
+		// A version number followed by the UTF-8 target
+		if len(b) < 4 {
+			return corrupt
+		}
+		rp.SubstituteName = string(b[4:])
+		rp.PrintName = rp.SubstituteName
+	case ReparseTagWOF:
+		if len(b) < 8 {
+			return corrupt
+		}
+		rp.WOFVersion = binary.LittleEndian.Uint32(b[0:4])
+		rp.WOFProvider = binary.LittleEndian.Uint32(b[4:8])
+	}
+	return nil
+}
+
+// decodeUTF16 converts little-endian UTF-16 data to a string.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
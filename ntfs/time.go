@@ -0,0 +1,77 @@
+package ntfs
+
+import (
+	"errors"
+	"time"
+)
+
+// epochOffset is the number of 100-nanosecond intervals between the NTFS
+// epoch of January 1, 1601 UTC and the Unix epoch.
+const epochOffset = 116444736000000000
+
+// Time is an NTFS timestamp, expressed as the number of 100-nanosecond
+// intervals that have elapsed since January 1, 1601 UTC. It shares its
+// representation with the NTTIME values used by Samba.
+type Time uint64
+
+// NewTime returns the NTFS timestamp for the given time.
+func NewTime(t time.Time) Time {
+	return Time(t.Unix()*1e7 + int64(t.Nanosecond())/100 + epochOffset)
+}
+
+// Time returns the timestamp as a time.Time.
+func (t Time) Time() time.Time {
+	v := int64(t) - epochOffset
+	return time.Unix(v/1e7, v%1e7*100)
+}
+
+// MarshalBinary writes the timestamp in the format used by the
+// system.ntfs_crtime extended attribute.
+func (t Time) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 8)
+	nativeEndian.PutUint64(data, uint64(t))
+	return
+}
+
+// UnmarshalBinary reads a timestamp from a byte slice containing
+// system.ntfs_crtime extended attribute data.
+func (t *Time) UnmarshalBinary(data []byte) error {
+	if len(data) != 8 {
+		return errors.New("NTFS time data has an invalid length")
+	}
+	*t = Time(nativeEndian.Uint64(data))
+	return nil
+}
+
+// Times stores the four timestamps that NTFS records for each file, in the
+// order in which they appear in the system.ntfs_times extended attribute.
+type Times struct {
+	CreationTime   Time
+	LastWriteTime  Time // Last change to the data of the file
+	LastAccessTime Time
+	ChangeTime     Time // Last change to the MFT record of the file
+}
+
+// MarshalBinary writes the timestamps in the format used by the
+// system.ntfs_times extended attribute.
+func (t Times) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 32)
+	nativeEndian.PutUint64(data[0:], uint64(t.CreationTime))
+	nativeEndian.PutUint64(data[8:], uint64(t.LastWriteTime))
+	nativeEndian.PutUint64(data[16:], uint64(t.LastAccessTime))
+	nativeEndian.PutUint64(data[24:], uint64(t.ChangeTime))
+	return
+}
+
+// UnmarshalBinary reads timestamps from a byte slice containing
+// system.ntfs_times extended attribute data.
+func (t *Times) UnmarshalBinary(data []byte) error {
+	if len(data) != 32 {
+		return errors.New("NTFS times data has an invalid length")
+	}
+	t.CreationTime = Time(nativeEndian.Uint64(data[0:]))
+	t.LastWriteTime = Time(nativeEndian.Uint64(data[8:]))
+	t.LastAccessTime = Time(nativeEndian.Uint64(data[16:]))
+	t.ChangeTime = Time(nativeEndian.Uint64(data[24:]))
+	return nil
+}
@@ -0,0 +1,305 @@
+package ntfs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// UserMappingPath is the path, relative to the root of an NTFS volume, of the
+// file from which the ntfs-3g file system driver reads the mapping between
+// Linux users and groups and Windows SIDs.
+const UserMappingPath = ".NTFS-3G/UserMapping"
+
+// UserMappingEntry is a line of a user mapping file, which has the form
+// "user:group:SID". An entry with a user maps the user to the SID and an
+// entry with a group maps the group to the SID. An entry with neither is the
+// implicit mapping pattern, which maps every user and group that has no
+// explicit mapping to a SID derived from its ID, and vice versa.
+type UserMappingEntry struct {
+	User  string // A user name or uid, or empty
+	Group string // A group name or gid, or empty
+	SID   ntsecurity.SID
+}
+
+// IsPattern returns true if the entry is an implicit mapping pattern.
+func (e UserMappingEntry) IsPattern() bool {
+	return e.User == "" && e.Group == ""
+}
+
+// UserMapping is the mapping between Linux users and groups and Windows SIDs
+// that ntfs-3g applies to a volume. It resolves identities exactly the way
+// ntfs-3g does, including its treatment of identities that are not mapped.
+type UserMapping struct {
+	entries []UserMappingEntry
+	users   []idMapping
+	groups  []idMapping
+}
+
+// idMapping is a user or group mapping in the form used by ntfs-3g, in which
+// an ID of zero denotes the implicit mapping pattern.
+type idMapping struct {
+	sid ntsecurity.SID
+	id  uint32
+}
+
+// NewUserMapping returns the mapping described by the entries. User and group
+// names are resolved to IDs immediately, as ntfs-3g resolves them when the
+// volume is mounted. As in ntfs_do_user_mapping and ntfs_do_group_mapping of
+// ntfs-3g, a user or group that resolves to zero, because it is root or
+// cannot be resolved, is not mapped, so that only the pattern has an ID of
+// zero.
+func NewUserMapping(entries []UserMappingEntry) *UserMapping {
+	m := &UserMapping{entries: entries}
+	for _, e := range entries {
+		pattern := e.IsPattern()
+		if pattern && !validPattern(e.SID) {
+			continue
+		}
+		uid := lookupID(e.User, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if (uid != 0 || pattern) && !knownGroupSID(e.SID) {
+			m.users = append(m.users, idMapping{sid: e.SID, id: uid})
+		}
+		gid := lookupID(e.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if gid != 0 || pattern {
+			m.groups = append(m.groups, idMapping{sid: e.SID, id: gid})
+		}
+	}
+	return m
+}
+
+// ReadUserMapping reads a user mapping file. Comments and lines that ntfs-3g
+// would not accept are skipped, as ntfs-3g skips them.
+func ReadUserMapping(r io.Reader) (*UserMapping, error) {
+	var entries []UserMappingEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		sid, err := ntsecurity.ParseSID(fields[2])
+		if err != nil {
+			continue
+		}
+		entries = append(entries, UserMappingEntry{User: fields[0], Group: fields[1], SID: sid})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewUserMapping(entries), nil
+}
+
+// UnmarshalText reads a mapping from the contents of a user mapping file.
+func (m *UserMapping) UnmarshalText(text []byte) error {
+	mapping, err := ReadUserMapping(bytes.NewReader(text))
+	if err != nil {
+		return err
+	}
+	*m = *mapping
+	return nil
+}
+
+// MarshalText writes the mapping in the format of a user mapping file.
+func (m *UserMapping) MarshalText() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, e := range m.entries {
+		buf.WriteString(e.User + ":" + e.Group + ":" + e.SID.String() + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// Entries returns the entries of the mapping.
+func (m *UserMapping) Entries() []UserMappingEntry {
+	return m.entries
+}
+
+// Active returns true if the mapping contains at least one valid user mapping
+// and one valid group mapping. ntfs-3g ignores the mapping otherwise.
+func (m *UserMapping) Active() bool {
+	return len(m.users) > 0 && len(m.groups) > 0
+}
+
+// UID returns the uid that ntfs-3g presents for a file owned by the SID.
+// SIDs that are not mapped explicitly or by the implicit pattern map to root.
+func (m *UserMapping) UID(sid ntsecurity.SID) uint32 {
+	return findID(m.users, sid, 0)
+}
+
+// GID returns the gid that ntfs-3g presents for a file whose group is the
+// SID. SIDs that are not mapped explicitly or by the implicit pattern map to
+// root.
+func (m *UserMapping) GID(sid ntsecurity.SID) uint32 {
+	return findID(m.groups, sid, 1)
+}
+
+// UserSID returns the SID that ntfs-3g records as the owner of a file owned
+// by the uid. Root maps to the local Administrators group. It returns false
+// if the uid is not mapped.
+func (m *UserMapping) UserSID(uid uint32) (ntsecurity.SID, bool) {
+	return findSID(m.users, uid, 0)
+}
+
+// GroupSID returns the SID that ntfs-3g records as the group of a file whose
+// group is the gid. Root maps to the local Administrators group. It returns
+// false if the gid is not mapped.
+func (m *UserMapping) GroupSID(gid uint32) (ntsecurity.SID, bool) {
+	return findSID(m.groups, gid, 1)
+}
+
+// findID follows ntfs_find_user and ntfs_find_group of ntfs-3g. The mappings
+// are searched in order until the SID or the implicit pattern, which is the
+// only mapping with an ID of zero, is found, so no mapping that follows the
+// pattern is ever consulted. The parity is 0 for users and 1 for groups.
+func findID(mappings []idMapping, sid ntsecurity.SID, parity uint32) uint32 {
+	for _, p := range mappings {
+		if p.id == 0 {
+			return findImplicit(sid, p.sid, parity)
+		}
+		if sid.Equal(p.sid) {
+			return p.id
+		}
+	}
+	return 0
+}
+
+// findSID follows ntfs_find_usid and ntfs_find_gsid of ntfs-3g.
+func findSID(mappings []idMapping, id uint32, parity uint32) (ntsecurity.SID, bool) {
+	if id == 0 {
+		return administratorsSID(), true
+	}
+	for _, p := range mappings {
+		if p.id == 0 {
+			return makeImplicit(id, p.sid, parity), true
+		}
+		if p.id == id {
+			return p.sid, true
+		}
+	}
+	return ntsecurity.SID{}, false
+}
+
+// findImplicit returns the ID that the implicit pattern maps the SID to, or
+// zero if the pattern does not apply to it. The pattern maps an ID to a SID of
+// the same domain, whose last sub-authority is that of the pattern plus twice
+// the lower 30 bits of the ID plus the parity. The upper 2 bits of the ID are
+// added to the second to last sub-authority.
+func findImplicit(sid ntsecurity.SID, pattern ntsecurity.SID, parity uint32) uint32 {
+	count := len(pattern.SubAuthority)
+	if count == 0 || len(sid.SubAuthority) != count {
+		return 0
+	}
+	last := sid.SubAuthority[count-1]
+	base := pattern.SubAuthority[count-1]
+	if last <= base || (last^base^parity)&1 != 0 {
+		return 0
+	}
+	id := ((last - base) >> 1) & 0x3fffffff
+	candidate := pattern
+	candidate.SubAuthority = append([]uint32(nil), pattern.SubAuthority...)
+	candidate.SubAuthority[count-1] = last
+	if candidate.Equal(sid) {
+		return id
+	}
+	if count < 2 {
+		return 0
+	}
+	for carry := uint32(1); carry < 4; carry++ {
+		candidate.SubAuthority[count-2]++
+		if candidate.Equal(sid) {
+			return id | carry<<30
+		}
+	}
+	return 0
+}
+
+// makeImplicit returns the SID that the implicit pattern maps the ID to.
+func makeImplicit(id uint32, pattern ntsecurity.SID, parity uint32) ntsecurity.SID {
+	sid := pattern
+	sid.SubAuthority = append([]uint32(nil), pattern.SubAuthority...)
+	count := len(sid.SubAuthority)
+	sid.SubAuthority[count-1] += 2*(id&0x3fffffff) + parity
+	if id&0xc0000000 != 0 && count >= 2 {
+		sid.SubAuthority[count-2] += id >> 30 & 3
+	}
+	return sid
+}
+
+// validPattern returns true if the SID can serve as the implicit mapping
+// pattern. Its last sub-authority must be at least 1000, as in Windows, and
+// small enough that the IDs added to it cannot overflow.
+func validPattern(sid ntsecurity.SID) bool {
+	count := len(sid.SubAuthority)
+	if count == 0 {
+		return false
+	}
+	last := sid.SubAuthority[count-1]
+	return last >= 1000 && last <= 0x7fffffff
+}
+
+// knownGroupSID returns true for the well-known group SIDs that ntfs-3g
+// refuses to map to users: S-1-5-4 (interactive users) and S-1-5-11
+// (authenticated users).
+func knownGroupSID(sid ntsecurity.SID) bool {
+	if len(sid.SubAuthority) != 1 || sid.IdentifierAuthority != ntsecurity.NTIdentifierAuthority() {
+		return false
+	}
+	return sid.SubAuthority[0] == 4 || sid.SubAuthority[0] == 11
+}
+
+// administratorsSID returns S-1-5-32-544, the SID of the local Administrators
+// group.
+func administratorsSID() ntsecurity.SID {
+	return ntsecurity.SID{
+		Revision:            1,
+		SubAuthorityCount:   2,
+		IdentifierAuthority: ntsecurity.NTIdentifierAuthority(),
+		SubAuthority:        []uint32{32, 544},
+	}
+}
+
+// lookupID returns the ID of a user or group field, as ntfs-3g determines
+// it. A field that starts with a digit is read as a number by atoi, which
+// reads only the leading digits. Any other field is a name, which is
+// resolved with the given function. An empty field and a name that cannot
+// be resolved read as zero.
+func lookupID(field string, lookup func(string) (string, error)) uint32 {
+	if field == "" {
+		return 0
+	}
+	if field[0] < '0' || field[0] > '9' {
+		v, err := lookup(field)
+		if err != nil {
+			return 0
+		}
+		id, _ := strconv.ParseUint(v, 10, 32)
+		return uint32(id)
+	}
+	end := 0
+	for end < len(field) && field[end] >= '0' && field[end] <= '9' {
+		end++
+	}
+	id, _ := strconv.ParseUint(field[:end], 10, 32)
+	return uint32(id)
+}
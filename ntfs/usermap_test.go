@@ -0,0 +1,148 @@
+package ntfs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// The expected SIDs follow the implicit mapping documented for ntfs-3g, in
+// which a pattern ending in 10000 maps uid N to 10000+2N and gid N to
+// 10000+2N+1. They were not produced by ntfs-3g.usermap, which was not
+// available.
+const testPattern = "S-1-5-21-1004336348-1177238915-682003330-10000"
+
+func TestImplicitMapping(t *testing.T) {
+	pattern := ntsecurity.MustParseSID(testPattern)
+	for _, test := range []struct {
+		id     uint32
+		parity uint32
+		sid    string
+	}{
+		{1000, 0, "S-1-5-21-1004336348-1177238915-682003330-12000"},
+		{1000, 1, "S-1-5-21-1004336348-1177238915-682003330-12001"},
+		{1, 0, "S-1-5-21-1004336348-1177238915-682003330-10002"},
+		{0x3fffffff, 1, "S-1-5-21-1004336348-1177238915-682003330-2147493647"},
+		// The upper two bits of the ID are carried into the sub-authority
+		// before the last
+		{0x400003e8, 0, "S-1-5-21-1004336348-1177238915-682003331-12000"},
+		{0xc00003e8, 1, "S-1-5-21-1004336348-1177238915-682003333-12001"},
+	} {
+		sid := makeImplicit(test.id, pattern, test.parity)
+		if sid.String() != test.sid {
+			t.Errorf("makeImplicit(%#x, %d) = %s, want %s", test.id, test.parity, sid, test.sid)
+		}
+		if id := findImplicit(ntsecurity.MustParseSID(test.sid), pattern, test.parity); id != test.id {
+			t.Errorf("findImplicit(%s, %d) = %#x, want %#x", test.sid, test.parity, id, test.id)
+		}
+	}
+
+	for _, test := range []struct {
+		sid    string
+		parity uint32
+	}{
+		{"S-1-5-21-1004336348-1177238915-682003330-12000", 1}, // The parity of a user
+		{"S-1-5-21-1004336348-1177238915-682003330-12001", 0}, // The parity of a group
+		{"S-1-5-21-1004336348-1177238915-682003330-10000", 0}, // The pattern itself
+		{"S-1-5-21-1004336348-1177238915-682003330-9998", 0},
+		{"S-1-5-21-1004336348-1177238915-682003334-12000", 0}, // Beyond the carry
+		{"S-1-5-21-1004336348-1177238916-682003330-12000", 0}, // Another domain
+		{"S-1-5-21-1004336348-1177238915-12000", 0},
+	} {
+		if id := findImplicit(ntsecurity.MustParseSID(test.sid), pattern, test.parity); id != 0 {
+			t.Errorf("findImplicit(%s, %d) = %#x, want 0", test.sid, test.parity, id)
+		}
+	}
+}
+
+func TestUserMapping(t *testing.T) {
+	m, err := ReadUserMapping(strings.NewReader(`# comment
+1001::S-1-5-21-1004336348-1177238915-682003330-500
+:1001:S-1-5-21-1004336348-1177238915-682003330-513
+0::S-1-5-21-1004336348-1177238915-682003330-501
+::` + testPattern + `
+1002::S-1-5-21-1004336348-1177238915-682003330-502
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Active() {
+		t.Fatal("Mapping is not active")
+	}
+	for _, test := range []struct {
+		sid      string
+		uid, gid uint32
+	}{
+		{"S-1-5-21-1004336348-1177238915-682003330-500", 1001, 0},
+		{"S-1-5-21-1004336348-1177238915-682003330-513", 0, 1001},
+		{"S-1-5-21-1004336348-1177238915-682003330-12000", 1000, 0},
+		{"S-1-5-21-1004336348-1177238915-682003330-12001", 0, 1000},
+		// Root cannot be mapped, and entries after the pattern are ignored
+		{"S-1-5-21-1004336348-1177238915-682003330-501", 0, 0},
+		{"S-1-5-21-1004336348-1177238915-682003330-502", 0, 0},
+	} {
+		sid := ntsecurity.MustParseSID(test.sid)
+		if uid, gid := m.UID(sid), m.GID(sid); uid != test.uid || gid != test.gid {
+			t.Errorf("%s maps to %d:%d, want %d:%d", test.sid, uid, gid, test.uid, test.gid)
+		}
+	}
+	if sid, ok := m.UserSID(0); !ok || sid.String() != "S-1-5-32-544" {
+		t.Errorf("UserSID(0) = %s, %v, want S-1-5-32-544", sid, ok)
+	}
+	if sid, ok := m.GroupSID(1002); !ok || sid.String() != "S-1-5-21-1004336348-1177238915-682003330-12005" {
+		t.Errorf("GroupSID(1002) = %s, %v", sid, ok)
+	}
+}
+
+func TestKnownGroupSID(t *testing.T) {
+	for sid, want := range map[string]bool{
+		"S-1-5-4":      true,
+		"S-1-5-11":     true,
+		"S-1-5-18":     false,
+		"S-1-5-32-544": false,
+		"S-1-1-0":      false,
+		"S-1-3-4":      false,
+	} {
+		if got := knownGroupSID(ntsecurity.MustParseSID(sid)); got != want {
+			t.Errorf("knownGroupSID(%s) = %v, want %v", sid, got, want)
+		}
+	}
+}
+
+func TestValidPattern(t *testing.T) {
+	for sid, want := range map[string]bool{
+		testPattern: true,
+		"S-1-5-21-1004336348-1177238915-682003330-1000":       true,
+		"S-1-5-21-1004336348-1177238915-682003330-999":        false,
+		"S-1-5-21-1004336348-1177238915-682003330-2147483647": true,
+		"S-1-5-21-1004336348-1177238915-682003330-2147483648": false,
+	} {
+		if got := validPattern(ntsecurity.MustParseSID(sid)); got != want {
+			t.Errorf("validPattern(%s) = %v, want %v", sid, got, want)
+		}
+	}
+}
+
+func TestLookupID(t *testing.T) {
+	lookup := func(name string) (string, error) {
+		if name == "alice" {
+			return "1000", nil
+		}
+		return "", errors.New("unknown")
+	}
+	for field, want := range map[string]uint32{
+		"":        0,
+		"1001":    1001,
+		"007":     7,
+		"1001abc": 1001, // atoi stops at the first non-digit
+		"alice":   1000,
+		"bob":     0,
+		"a1001":   0,
+	} {
+		if got := lookupID(field, lookup); got != want {
+			t.Errorf("lookupID(%q) = %d, want %d", field, got, want)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package ntsecurity
 import (
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -171,6 +174,59 @@ func (sid SID) SDDL() string {
 	return fmt.Sprint(sid)
 }
 
+var errInvalidSID = errors.New("Invalid security identifier string")
+
+// ParseSID parses a security identifier in the standard S-R-I-S... notation
+// described by the SID type. The identifier authority may be expressed in
+// decimal or, when prefixed by "0x", in hexadecimal.
+func ParseSID(s string) (sid SID, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 3 || !strings.EqualFold(parts[0], "S") {
+		return sid, errInvalidSID
+	}
+	revision, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil || revision < SidMinRevision || revision > SidMaxRevision {
+		return sid, errInvalidSID
+	}
+	var authority uint64
+	if strings.HasPrefix(parts[2], "0x") || strings.HasPrefix(parts[2], "0X") {
+		authority, err = strconv.ParseUint(parts[2][2:], 16, 48)
+	} else {
+		authority, err = strconv.ParseUint(parts[2], 10, 48)
+	}
+	if err != nil {
+		return sid, errInvalidSID
+	}
+	subAuthorities := parts[3:]
+	if len(subAuthorities) > SidMaxSubAuthorities {
+		return sid, errInvalidSID
+	}
+	sid.SubAuthority = make([]uint32, len(subAuthorities))
+	for i, part := range subAuthorities {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return SID{}, errInvalidSID
+		}
+		sid.SubAuthority[i] = uint32(v)
+	}
+	sid.Revision = uint8(revision)
+	sid.SubAuthorityCount = uint8(len(subAuthorities))
+	for i := range sid.IdentifierAuthority {
+		sid.IdentifierAuthority[i] = uint8(authority >> uint(40-8*i))
+	}
+	return sid, nil
+}
+
+// MustParseSID is like ParseSID but panics if the string cannot be parsed. It
+// simplifies the initialization of variables holding well-known SIDs.
+func MustParseSID(s string) SID {
+	sid, err := ParseSID(s)
+	if err != nil {
+		panic(`ntsecurity: ParseSID(` + strconv.Quote(s) + `): ` + err.Error())
+	}
+	return sid
+}
+
 const (
 	sddlAccessAllowedTag         = "A"
 	sddlAccessDeniedTag          = "D"
@@ -70,6 +70,19 @@ func (sid SID) String() (output string) {
 	return
 }
 
+// Equal returns true if the security identifiers are identical.
+func (sid SID) Equal(other SID) bool {
+	if sid.Revision != other.Revision || sid.IdentifierAuthority != other.IdentifierAuthority || len(sid.SubAuthority) != len(other.SubAuthority) {
+		return false
+	}
+	for i := range sid.SubAuthority {
+		if sid.SubAuthority[i] != other.SubAuthority[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // An ACL starts with an ACL header structure, which specifies the size of
 // the ACL and the number of ACEs it contains. The ACL header is followed by
 // zero or more access control entries (ACEs). The ACL as well as each ACE
@@ -180,14 +193,14 @@ func (value SecurityDescriptorControl) HasFlag(flag SecurityDescriptorControl) b
 type IdentifierAuthority [6]uint8
 
 func (b IdentifierAuthority) Uint64() uint64 {
-	return uint64(b[0])<<38 | uint64(b[1])<<30 | uint64(b[2])<<24 | uint64(b[3])<<16 | uint64(b[4])<<8 | uint64(b[5])
+	return uint64(b[0])<<40 | uint64(b[1])<<32 | uint64(b[2])<<24 | uint64(b[3])<<16 | uint64(b[4])<<8 | uint64(b[5])
 }
 
 // See https://msdn.microsoft.com/en-us/library/windows/desktop/aa379649
 
 var (
 	SecurityNullRelativeSID uint32 = 0
-	SecurityWorldRID        uint32 = 1
+	SecurityWorldRID        uint32 = 0
 )
 
 // NullIdentifierAuthority represents SID S-1-0
@@ -220,6 +233,23 @@ func NTIdentifierAuthority() IdentifierAuthority {
 	return IdentifierAuthority{0, 0, 0, 0, 0, 5}
 }
 
+// WorldSID returns S-1-1-0, the SID of Everyone.
+func WorldSID() SID {
+	return SID{Revision: 1, SubAuthorityCount: 1, IdentifierAuthority: WorldIdentifierAuthority(), SubAuthority: []uint32{SecurityWorldRID}}
+}
+
+// CreatorOwnerSID returns S-1-3-0, which stands for the owner of an object in
+// the inheritable entries of its parent.
+func CreatorOwnerSID() SID {
+	return SID{Revision: 1, SubAuthorityCount: 1, IdentifierAuthority: CreatorIdentifierAuthority(), SubAuthority: []uint32{0}}
+}
+
+// CreatorGroupSID returns S-1-3-1, which stands for the primary group of an
+// object in the inheritable entries of its parent.
+func CreatorGroupSID() SID {
+	return SID{Revision: 1, SubAuthorityCount: 1, IdentifierAuthority: CreatorIdentifierAuthority(), SubAuthority: []uint32{1}}
+}
+
 // AccessControlType specifies the type of an access control entry and determines
 // the data structure used to represent it
 type AccessControlType uint8
@@ -399,6 +429,41 @@ const (
 	GenericRead AccessMask = 0x80000000
 )
 
+// GenericMapping specifies the specific and standard rights that the generic
+// rights stand for when they are applied to a particular kind of object.
+type GenericMapping struct {
+	Read    AccessMask
+	Write   AccessMask
+	Execute AccessMask
+	All     AccessMask
+}
+
+// FileGenericMapping is the generic mapping of files and directories.
+var FileGenericMapping = GenericMapping{
+	Read:    StandardRightsRead | FileReadData | FileReadAttributes | FileReadEA | Synchronize,
+	Write:   StandardRightsWrite | FileWriteData | FileWriteAttributes | FileWriteEA | FileAppendData | Synchronize,
+	Execute: StandardRightsExecute | FileReadAttributes | FileExecute | Synchronize,
+	All:     StandardRightsRequired | Synchronize | 0x1ff,
+}
+
+// MapGeneric returns the access mask with its generic rights replaced by the
+// rights that they stand for according to the mapping.
+func (m AccessMask) MapGeneric(mapping GenericMapping) AccessMask {
+	if m&GenericRead != 0 {
+		m |= mapping.Read
+	}
+	if m&GenericWrite != 0 {
+		m |= mapping.Write
+	}
+	if m&GenericExecute != 0 {
+		m |= mapping.Execute
+	}
+	if m&GenericAll != 0 {
+		m |= mapping.All
+	}
+	return m &^ (GenericRead | GenericWrite | GenericExecute | GenericAll)
+}
+
 type GUID [16]byte // TODO: Decide whether we really should roll our own GUID type
 
 // See: http://en.wikipedia.org/wiki/Universally_unique_identifier
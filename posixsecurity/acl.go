@@ -0,0 +1,86 @@
+package posixsecurity
+
+import "os"
+
+// The names of the extended attributes in which Linux stores POSIX ACLs.
+const (
+	// AccessACLName is the extended attribute that holds the access ACL of a
+	// file, which determines the access granted to the file itself.
+	AccessACLName = "system.posix_acl_access"
+
+	// DefaultACLName is the extended attribute that holds the default ACL of
+	// a directory, which is inherited by files created in it.
+	DefaultACLName = "system.posix_acl_default"
+)
+
+// ACLVersion is the version of the extended attribute format of POSIX ACLs,
+// which is the only one that Linux understands.
+const ACLVersion = 2
+
+// UndefinedID is the ID of the entries whose tag does not call for one.
+const UndefinedID = ^uint32(0)
+
+// Tag specifies the kind of an ACL entry and determines who it applies to.
+type Tag uint16
+
+const (
+	// UserObj is the entry of the owner of the file.
+	UserObj Tag = 0x01
+
+	// User is the entry of the user identified by the ID of the entry.
+	User Tag = 0x02
+
+	// GroupObj is the entry of the group of the file.
+	GroupObj Tag = 0x04
+
+	// Group is the entry of the group identified by the ID of the entry.
+	Group Tag = 0x08
+
+	// Mask is the entry that limits the permissions granted by the User,
+	// GroupObj and Group entries.
+	Mask Tag = 0x10
+
+	// Other is the entry of everyone who matches no other entry.
+	Other Tag = 0x20
+)
+
+// Perm holds the read, write and execute permissions of an ACL entry, in the
+// same bits as in the permissions of a file mode.
+type Perm uint16
+
+const (
+	Execute Perm = 0x01
+	Write   Perm = 0x02
+	Read    Perm = 0x04
+)
+
+// FileMode returns the permissions in the lowest three bits of a mode.
+func (p Perm) FileMode() os.FileMode {
+	return os.FileMode(p & (Read | Write | Execute))
+}
+
+// An Entry of an ACL grants permissions to the user or group identified by
+// its tag and, for named users and groups, its ID.
+type Entry struct {
+	Tag  Tag
+	Perm Perm
+	ID   uint32
+}
+
+// An ACL is a POSIX access control list. A valid ACL has exactly one
+// UserObj, GroupObj and Other entry, and a Mask entry if it has any User or
+// Group entries. Its entries are sorted by tag and then by ID, and the ID of
+// each User and Group entry is unique.
+type ACL []Entry
+
+// Minimal returns true if the ACL has no entries beyond the UserObj, GroupObj
+// and Other entries, and so is equivalent to the permission bits of a mode.
+func (acl ACL) Minimal() bool {
+	for _, e := range acl {
+		switch e.Tag {
+		case User, Group, Mask:
+			return false
+		}
+	}
+	return true
+}
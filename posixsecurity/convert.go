@@ -0,0 +1,112 @@
+package posixsecurity
+
+import (
+	"sort"
+
+	"go.scj.io/samba-over-ntfs/idmap"
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// AccessACL returns the POSIX access ACL that the DACL of the security
+// descriptor projects onto. The permissions of each entry are computed as
+// by Mode: the UserObj, GroupObj and Other entries hold the rights of the
+// owner, the group and Everyone, and the SIDs of the other entries of the
+// DACL become User or Group entries holding their own rights and those of
+// Everyone. SIDs that the mapping cannot map to a uid or gid are left out,
+// except for the Unix user and group SIDs of Samba, and the mapping may be
+// nil.
+func AccessACL(sd *ntsecurity.SecurityDescriptor, ids idmap.Backend) ACL {
+	if sd.DACL == nil {
+		return ACL{
+			{Tag: UserObj, Perm: Read | Write | Execute, ID: UndefinedID},
+			{Tag: GroupObj, Perm: Read | Write | Execute, ID: UndefinedID},
+			{Tag: Other, Perm: Read | Write | Execute, ID: UndefinedID},
+		}
+	}
+	return projectACL(objectEntries(sd.DACL), sd.Owner, sd.Group, ids)
+}
+
+// DefaultACL returns the POSIX default ACL that the inheritable entries of
+// the DACL of the security descriptor project onto, or nil if the DACL has
+// none. Entries for CREATOR OWNER (S-1-3-0) and CREATOR GROUP (S-1-3-1)
+// become the UserObj and GroupObj entries, since they apply to the owner and
+// group of the files that inherit them.
+func DefaultACL(sd *ntsecurity.SecurityDescriptor, ids idmap.Backend) ACL {
+	if sd.DACL == nil {
+		return nil
+	}
+	var entries []ntsecurity.ACE
+	for _, ace := range sd.DACL.Entries {
+		if ace.Flags&(ntsecurity.ObjectInheritFlag|ntsecurity.ContainerInheritFlag) != 0 {
+			entries = append(entries, ace)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	owner, group := ntsecurity.CreatorOwnerSID(), ntsecurity.CreatorGroupSID()
+	return projectACL(entries, &owner, &group, ids)
+}
+
+// projectACL returns the POSIX ACL that the entries of a DACL project onto,
+// for a file with the given owner and group, either of which may be nil.
+func projectACL(entries []ntsecurity.ACE, owner, group *ntsecurity.SID, ids idmap.Backend) ACL {
+	world := ntsecurity.WorldSID()
+	known := []ntsecurity.SID{world}
+	ownerSIDs, groupSIDs := []ntsecurity.SID{world}, []ntsecurity.SID{world}
+	if owner != nil {
+		known = append(known, *owner)
+		ownerSIDs = append(ownerSIDs, *owner)
+	}
+	if group != nil {
+		known = append(known, *group)
+		groupSIDs = append(groupSIDs, *group)
+	}
+	acl := ACL{
+		{Tag: UserObj, Perm: permissions(effectiveRights(entries, ownerSIDs...)), ID: UndefinedID},
+		{Tag: GroupObj, Perm: permissions(effectiveRights(entries, groupSIDs...)), ID: UndefinedID},
+		{Tag: Other, Perm: permissions(effectiveRights(entries, world)), ID: UndefinedID},
+	}
+
+	// Several SIDs may map to the same ID
+	named := make(map[qualifier]Perm)
+	for _, ace := range entries {
+		if matchSID(ace.SID, known) {
+			continue
+		}
+		known = append(known, ace.SID)
+		typ, id, err := idmap.ResolveSID(ids, ace.SID)
+		if err != nil {
+			continue
+		}
+		tag := User
+		if typ == idmap.GroupID {
+			tag = Group
+		}
+		named[qualifier{tag, id}] |= permissions(effectiveRights(entries, ace.SID, world))
+	}
+	if len(named) > 0 {
+		// The mask must not withhold any of the permissions granted by the
+		// entries that it limits
+		mask := Entry{Tag: Mask, Perm: acl[1].Perm, ID: UndefinedID}
+		for q, perm := range named {
+			acl = append(acl, Entry{Tag: q.tag, Perm: perm, ID: q.id})
+			mask.Perm |= perm
+		}
+		acl = append(acl, mask)
+	}
+
+	sort.Slice(acl, func(i, j int) bool {
+		if acl[i].Tag != acl[j].Tag {
+			return acl[i].Tag < acl[j].Tag
+		}
+		return acl[i].ID < acl[j].ID
+	})
+	return acl
+}
+
+// qualifier identifies a User or Group entry.
+type qualifier struct {
+	tag Tag
+	id  uint32
+}
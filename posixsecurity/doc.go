@@ -0,0 +1,9 @@
+/*
+Package posixsecurity projects NT security descriptors onto the POSIX
+permission model and back.
+
+The projection follows the one that Samba and the ntfs-3g driver apply, so
+that programs which only understand POSIX permissions see the access that the
+NT ACL of a file actually grants.
+*/
+package posixsecurity
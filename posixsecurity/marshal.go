@@ -0,0 +1,30 @@
+package posixsecurity
+
+import "encoding/binary"
+
+// The lengths of the header and the entries of the extended attribute format
+// of POSIX ACLs.
+const (
+	headerLength = 4
+	entryLength  = 8
+)
+
+// MarshalBinary encodes the ACL in the little-endian extended attribute
+// format that Linux uses for system.posix_acl_access and
+// system.posix_acl_default.
+func (acl ACL) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, acl.BinaryLength())
+	binary.LittleEndian.PutUint32(data[0:4], ACLVersion)
+	for i, e := range acl {
+		b := data[headerLength+i*entryLength:]
+		binary.LittleEndian.PutUint16(b[0:2], uint16(e.Tag))
+		binary.LittleEndian.PutUint16(b[2:4], uint16(e.Perm))
+		binary.LittleEndian.PutUint32(b[4:8], e.ID)
+	}
+	return
+}
+
+// BinaryLength returns the number of bytes required to encode the ACL.
+func (acl ACL) BinaryLength() int {
+	return headerLength + len(acl)*entryLength
+}
@@ -0,0 +1,99 @@
+package posixsecurity
+
+import (
+	"os"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// The rights that are required for each of the POSIX permissions. The same
+// bits stand for listing, adding entries to and traversing a directory.
+const (
+	readRights    = ntsecurity.FileReadData
+	writeRights   = ntsecurity.FileWriteData
+	executeRights = ntsecurity.FileExecute
+)
+
+// Mode returns the permission bits that the DACL of the security descriptor
+// grants to the owner, the group and everyone else. The permissions of the
+// owner and group are the rights that the DACL grants to their SIDs and to
+// Everyone (S-1-1-0), and those of everyone else are the rights it grants to
+// Everyone. As with ntfs-3g, no other SID is considered, since membership of
+// other groups cannot be determined.
+//
+// A security descriptor without a DACL grants all permissions and one with
+// an empty DACL grants none.
+func Mode(sd *ntsecurity.SecurityDescriptor) os.FileMode {
+	if sd.DACL == nil {
+		return os.ModePerm
+	}
+	entries := objectEntries(sd.DACL)
+	world := ntsecurity.WorldSID()
+	owner, group := []ntsecurity.SID{world}, []ntsecurity.SID{world}
+	if sd.Owner != nil {
+		owner = append(owner, *sd.Owner)
+	}
+	if sd.Group != nil {
+		group = append(group, *sd.Group)
+	}
+	return permissions(effectiveRights(entries, owner...)).FileMode()<<6 |
+		permissions(effectiveRights(entries, group...)).FileMode()<<3 |
+		permissions(effectiveRights(entries, world)).FileMode()
+}
+
+// objectEntries returns the entries of the ACL that apply to the object
+// itself, leaving out those that are only inherited by its children.
+func objectEntries(acl *ntsecurity.ACL) []ntsecurity.ACE {
+	var entries []ntsecurity.ACE
+	for _, ace := range acl.Entries {
+		if !ace.Flags.HasFlag(ntsecurity.InheritOnlyFlag) {
+			entries = append(entries, ace)
+		}
+	}
+	return entries
+}
+
+// effectiveRights returns the rights that the entries grant to a trustee that
+// is identified by any of the SIDs. The entries are evaluated in order, as
+// Windows evaluates them, so a right that is denied before it is allowed is
+// not granted.
+func effectiveRights(entries []ntsecurity.ACE, sids ...ntsecurity.SID) ntsecurity.AccessMask {
+	var allowed, denied ntsecurity.AccessMask
+	for _, ace := range entries {
+		if !matchSID(ace.SID, sids) {
+			continue
+		}
+		mask := ace.Mask.MapGeneric(ntsecurity.FileGenericMapping)
+		switch ace.Type {
+		case ntsecurity.AccessAllowedControl:
+			allowed |= mask &^ denied
+		case ntsecurity.AccessDeniedControl:
+			denied |= mask &^ allowed
+		}
+	}
+	return allowed
+}
+
+// permissions returns the POSIX permissions that correspond to the rights.
+func permissions(rights ntsecurity.AccessMask) Perm {
+	var perm Perm
+	if rights&readRights == readRights {
+		perm |= Read
+	}
+	if rights&writeRights == writeRights {
+		perm |= Write
+	}
+	if rights&executeRights == executeRights {
+		perm |= Execute
+	}
+	return perm
+}
+
+func matchSID(sid ntsecurity.SID, sids []ntsecurity.SID) bool {
+	for _, s := range sids {
+		if sid.Equal(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package posixsecurity
+
+import (
+	"os"
+
+	"go.scj.io/samba-over-ntfs/idmap"
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// inheritFlags are the flags of the entries that a default ACL projects onto.
+const inheritFlags = ntsecurity.ObjectInheritFlag | ntsecurity.ContainerInheritFlag | ntsecurity.InheritOnlyFlag
+
+// FromMode returns the minimal ACL that is equivalent to the permission bits
+// of the mode.
+func FromMode(mode os.FileMode) ACL {
+	return ACL{
+		{Tag: UserObj, Perm: Perm(mode>>6) & (Read | Write | Execute), ID: UndefinedID},
+		{Tag: GroupObj, Perm: Perm(mode>>3) & (Read | Write | Execute), ID: UndefinedID},
+		{Tag: Other, Perm: Perm(mode) & (Read | Write | Execute), ID: UndefinedID},
+	}
+}
+
+// SecurityDescriptor returns an NT security descriptor for a file with the
+// given owner, group and mode that grants what the POSIX ACL grants. It is
+// modelled on the descriptors that Samba's posix_acls.c presents, but departs
+// from them where noted below. The access ACL determines the DACL if it is
+// given and the mode does otherwise. The default ACL, which only directories have,
+// adds entries that are inherited by new files, with the UserObj and GroupObj
+// entries standing for CREATOR OWNER and CREATOR GROUP.
+//
+// Users and groups are identified by the SIDs that the mapping maps them to,
+// or by the Unix user and group SIDs of Samba if they are not mapped. The
+// mapping may be nil.
+//
+// The DACL grants each user and group the permissions of its entry, limited
+// by the mask. Since Windows grants a user the rights of every entry that
+// applies to it, while POSIX only applies the most specific one, each entry
+// is preceded by an entry that denies the permissions that the entry lacks
+// but that less specific entries grant: the owner and named users are denied
+// those that any group entry or the Other entry grants, and groups those
+// that the Other entry grants. Group membership is not known here, so users
+// are denied the permissions of every group entry. Samba does not add these
+// deny entries, and it grants WRITE_OWNER in place of no permissions so that
+// Windows NT displays the entry, while entries without permissions are left
+// out here.
+func SecurityDescriptor(uid, gid uint32, mode os.FileMode, access, def ACL, ids idmap.Backend) *ntsecurity.SecurityDescriptor {
+	owner := idmap.ResolveID(ids, uid, idmap.UserID)
+	group := idmap.ResolveID(ids, gid, idmap.GroupID)
+	if access == nil {
+		access = FromMode(mode)
+	}
+	deny, allow := projectPOSIX(access, owner, group, 0, ids)
+	if def != nil && mode.IsDir() {
+		d, a := projectPOSIX(def, ntsecurity.CreatorOwnerSID(), ntsecurity.CreatorGroupSID(), inheritFlags, ids)
+		deny = mergeEntries(deny, d)
+		allow = mergeEntries(allow, a)
+	}
+	return &ntsecurity.SecurityDescriptor{
+		Revision: 1,
+		Control:  ntsecurity.SelfRelative | ntsecurity.DACLPresent,
+		Owner:    &owner,
+		Group:    &group,
+		DACL: &ntsecurity.ACL{
+			Revision: ntsecurity.MinACLRevision,
+			Entries:  append(deny, allow...),
+		},
+	}
+}
+
+// projectPOSIX returns the entries that deny and allow the permissions of
+// the ACL, with the given flags, for a file with the given owner and group.
+func projectPOSIX(acl ACL, owner, group ntsecurity.SID, flags ntsecurity.AccessControlFlag, ids idmap.Backend) (deny, allow []ntsecurity.ACE) {
+	mask := Read | Write | Execute
+	var userObj, groupObj, other Perm
+	for _, e := range acl {
+		switch e.Tag {
+		case UserObj:
+			userObj = e.Perm
+		case GroupObj:
+			groupObj = e.Perm
+		case Mask:
+			mask = e.Perm
+		case Other:
+			other = e.Perm
+		}
+	}
+
+	add := func(sid ntsecurity.SID, perm, denied Perm) {
+		denied &^= perm
+		if denied != 0 {
+			deny = append(deny, ntsecurity.ACE{
+				Type:  ntsecurity.AccessDeniedControl,
+				Flags: flags,
+				Mask:  deniedRights(denied),
+				SID:   sid,
+			})
+		}
+		if perm != 0 {
+			allow = append(allow, ntsecurity.ACE{
+				Type:  ntsecurity.AccessAllowedControl,
+				Flags: flags,
+				Mask:  allowedRights(perm),
+				SID:   sid,
+			})
+		}
+	}
+	groups := groupObj & mask
+	for _, e := range acl {
+		if e.Tag == Group {
+			groups |= e.Perm & mask
+		}
+	}
+	add(owner, userObj, other|groups)
+	for _, e := range acl {
+		if e.Tag == User {
+			add(idmap.ResolveID(ids, e.ID, idmap.UserID), e.Perm&mask, other|groups)
+		}
+	}
+	add(group, groupObj&mask, other)
+	for _, e := range acl {
+		if e.Tag == Group {
+			add(idmap.ResolveID(ids, e.ID, idmap.GroupID), e.Perm&mask, other)
+		}
+	}
+	add(ntsecurity.WorldSID(), other, 0)
+	return
+}
+
+// mergeEntries appends the inheritable entries to the entries of the object.
+// As Samba does, an inheritable entry that is identical to an entry of the
+// object is merged into it, so that the entry applies to both.
+func mergeEntries(entries, inheritable []ntsecurity.ACE) []ntsecurity.ACE {
+	n := len(entries)
+outer:
+	for _, ace := range inheritable {
+		for i := range entries[:n] {
+			e := &entries[i]
+			if e.Type == ace.Type && e.Mask == ace.Mask && e.SID.Equal(ace.SID) && e.Flags == 0 {
+				e.Flags = ace.Flags &^ ntsecurity.InheritOnlyFlag
+				continue outer
+			}
+		}
+		entries = append(entries, ace)
+	}
+	return entries
+}
+
+// allowedRights returns the rights that Samba grants for the permissions.
+// Full permissions grant all rights, and each permission otherwise grants the
+// rights of the corresponding generic right.
+func allowedRights(perm Perm) ntsecurity.AccessMask {
+	if perm&(Read|Write|Execute) == Read|Write|Execute {
+		return ntsecurity.FileGenericMapping.All
+	}
+	var rights ntsecurity.AccessMask
+	if perm&Read != 0 {
+		rights |= ntsecurity.FileGenericMapping.Read
+	}
+	if perm&Write != 0 {
+		rights |= ntsecurity.FileGenericMapping.Write
+	}
+	if perm&Execute != 0 {
+		rights |= ntsecurity.FileGenericMapping.Execute
+	}
+	return rights
+}
+
+// deniedRights returns the rights that are denied to withhold the
+// permissions. Only the rights that are specific to each permission are
+// denied, since the generic rights share others, such as the right to read
+// the attributes of the file.
+func deniedRights(perm Perm) ntsecurity.AccessMask {
+	var rights ntsecurity.AccessMask
+	if perm&Read != 0 {
+		rights |= ntsecurity.FileReadData
+	}
+	if perm&Write != 0 {
+		rights |= ntsecurity.FileWriteData | ntsecurity.FileAppendData
+	}
+	if perm&Execute != 0 {
+		rights |= ntsecurity.FileExecute
+	}
+	return rights
+}
@@ -0,0 +1,66 @@
+package posixsecurity
+
+import (
+	"os"
+	"testing"
+)
+
+// The expected DACLs follow the rules documented by SecurityDescriptor. They
+// have not been compared with the output of smbcacls, which was not
+// available. In the named case user 1001 is denied the write and execute
+// permissions that the group entries grant.
+func TestSecurityDescriptor(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		mode   os.FileMode
+		access ACL
+		def    ACL
+		dacl   string
+	}{
+		{
+			name: "mode",
+			mode: 0640,
+			dacl: "(A;;0x0012019f;;;S-1-22-1-1000)(A;;0x00120089;;;S-1-22-2-100)",
+		},
+		{
+			name: "named",
+			mode: 0750,
+			access: ACL{
+				{Tag: UserObj, Perm: Read | Write | Execute, ID: UndefinedID},
+				{Tag: User, Perm: Read, ID: 1001},
+				{Tag: GroupObj, Perm: Read | Execute, ID: UndefinedID},
+				{Tag: Group, Perm: Read | Write, ID: 101},
+				{Tag: Mask, Perm: Read | Write | Execute, ID: UndefinedID},
+				{Tag: Other, Perm: 0, ID: UndefinedID},
+			},
+			dacl: "(D;;0x00000026;;;S-1-22-1-1001)(A;;0x001f01ff;;;S-1-22-1-1000)(A;;0x00120089;;;S-1-22-1-1001)(A;;0x001200a9;;;S-1-22-2-100)(A;;0x0012019f;;;S-1-22-2-101)",
+		},
+		{
+			name: "masked",
+			mode: 0750,
+			access: ACL{
+				{Tag: UserObj, Perm: Read | Write | Execute, ID: UndefinedID},
+				{Tag: User, Perm: Read | Write, ID: 1001},
+				{Tag: GroupObj, Perm: Read | Execute, ID: UndefinedID},
+				{Tag: Mask, Perm: Read, ID: UndefinedID},
+				{Tag: Other, Perm: Read, ID: UndefinedID},
+			},
+			dacl: "(A;;0x001f01ff;;;S-1-22-1-1000)(A;;0x00120089;;;S-1-22-1-1001)(A;;0x00120089;;;S-1-22-2-100)(A;;0x00120089;;;WD)",
+		},
+		{
+			name: "default",
+			mode: os.ModeDir | 0755,
+			def: ACL{
+				{Tag: UserObj, Perm: Read | Write | Execute, ID: UndefinedID},
+				{Tag: GroupObj, Perm: Read | Execute, ID: UndefinedID},
+				{Tag: Other, Perm: Read | Execute, ID: UndefinedID},
+			},
+			dacl: "(A;;0x001f01ff;;;S-1-22-1-1000)(A;;0x001200a9;;;S-1-22-2-100)(A;OICI;0x001200a9;;;WD)(A;OICIIO;0x001f01ff;;;S-1-3-0)(A;OICIIO;0x001200a9;;;S-1-3-1)",
+		},
+	} {
+		sd := SecurityDescriptor(1000, 100, test.mode, test.access, test.def, nil)
+		if dacl := sd.DACL.SDDL(); dacl != test.dacl {
+			t.Errorf("%s: DACL is %s, want %s", test.name, dacl, test.dacl)
+		}
+	}
+}
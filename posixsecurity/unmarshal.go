@@ -0,0 +1,33 @@
+package posixsecurity
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	errInvalidLength  = errors.New("Invalid POSIX ACL length")
+	errInvalidVersion = errors.New("Unsupported POSIX ACL version")
+)
+
+// UnmarshalBinary decodes an ACL from the extended attribute format that
+// Linux uses for system.posix_acl_access and system.posix_acl_default.
+func (acl *ACL) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLength || (len(data)-headerLength)%entryLength != 0 {
+		return errInvalidLength
+	}
+	if binary.LittleEndian.Uint32(data[0:4]) != ACLVersion {
+		return errInvalidVersion
+	}
+	entries := make(ACL, (len(data)-headerLength)/entryLength)
+	for i := range entries {
+		b := data[headerLength+i*entryLength:]
+		entries[i] = Entry{
+			Tag:  Tag(binary.LittleEndian.Uint16(b[0:2])),
+			Perm: Perm(binary.LittleEndian.Uint16(b[2:4])),
+			ID:   binary.LittleEndian.Uint32(b[4:8]),
+		}
+	}
+	*acl = entries
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// xattrCacheSize is the number of files whose converted extended attributes
+// are kept in memory.
+const xattrCacheSize = 4096
+
+// xattrCache holds extended attributes that were converted from the
+// attributes of the underlying file system, and other values derived from
+// them, so that they need not be read and converted again each time they are
+// requested.
+//
+// The values of a file are stored along with its change time, which is updated
+// by the underlying file system whenever the attributes they were derived from
+// change. A change in the change time discards the values.
+type xattrCache struct {
+	mu      sync.Mutex
+	files   map[cacheID]*list.Element
+	recency list.List // Of *cacheEntry, most recently used first
+}
+
+// cacheID identifies a file by its device and inode number.
+type cacheID struct {
+	dev uint64
+	ino uint64
+}
+
+type cacheEntry struct {
+	id     cacheID
+	ctime  syscall.Timespec
+	values map[string]interface{}
+}
+
+var sambaCache = &xattrCache{files: make(map[cacheID]*list.Element)}
+
+func fileCacheID(fi os.FileInfo) (cacheID, syscall.Timespec) {
+	st := fi.Sys().(*syscall.Stat_t)
+	return cacheID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, st.Ctim
+}
+
+// get returns the named value of the file described by fi, if it is cached and
+// the file has not changed since.
+func (c *xattrCache) get(fi os.FileInfo, name string) (interface{}, bool) {
+	id, ctime := fileCacheID(fi)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.files[id]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if entry.ctime != ctime {
+		c.recency.Remove(e)
+		delete(c.files, id)
+		return nil, false
+	}
+	v, ok := entry.values[name]
+	if ok {
+		c.recency.MoveToFront(e)
+	}
+	return v, ok
+}
+
+// put stores the named value of the file described by fi. The value must not
+// be modified afterwards.
+func (c *xattrCache) put(fi os.FileInfo, name string, v interface{}) {
+	id, ctime := fileCacheID(fi)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.files[id]; ok {
+		entry := e.Value.(*cacheEntry)
+		if entry.ctime != ctime {
+			entry.ctime = ctime
+			entry.values = make(map[string]interface{})
+		}
+		entry.values[name] = v
+		c.recency.MoveToFront(e)
+		return
+	}
+	if c.recency.Len() >= xattrCacheSize {
+		oldest := c.recency.Back()
+		c.recency.Remove(oldest)
+		delete(c.files, oldest.Value.(*cacheEntry).id)
+	}
+	c.files[id] = c.recency.PushFront(&cacheEntry{
+		id:     id,
+		ctime:  ctime,
+		values: map[string]interface{}{name: v},
+	})
+}
+
+// purge discards the values of the file described by fi. It is used when the
+// attributes are changed through the file system, in case the change time of
+// the underlying file system is too coarse to reflect the change.
+func (c *xattrCache) purge(fi os.FileInfo) {
+	id, _ := fileCacheID(fi)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.files[id]; ok {
+		c.recency.Remove(e)
+		delete(c.files, id)
+	}
+}
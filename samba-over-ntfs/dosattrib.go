@@ -0,0 +1,111 @@
+package main
+
+import (
+	"syscall"
+
+	"bazil.org/fuse"
+
+	"go.scj.io/samba-over-ntfs/mirrorfs"
+	"go.scj.io/samba-over-ntfs/ntfs"
+	"go.scj.io/samba-over-ntfs/sambasecurity"
+)
+
+const dosXAttr = sambasecurity.DOSAttributesName
+
+// hasNTFSAttributes returns true if the underlying file system exposes NTFS
+// file attributes for the file.
+func hasNTFSAttributes(n *mirrorfs.Node) bool {
+	_, err := n.GetXAttr(ntfs.FileAttributesName, 0, 0)
+	return err == nil
+}
+
+// readDOSAttributes synthesizes Samba DOS attribute data from the NTFS file
+// attributes and creation time of the file. This is the only way that the
+// creation time reaches Samba, since FUSE on Linux cannot carry it in the
+// attributes of the file.
+func readDOSAttributes(n *mirrorfs.Node) ([]byte, error) {
+	data, err := n.GetXAttr(ntfs.FileAttributesName, xattrSizeMax, 0)
+	if err != nil {
+		return nil, err
+	}
+	var attrib ntfs.FileAttributes
+	if err = attrib.UnmarshalBinary(data); err != nil {
+		return nil, fuse.EIO
+	}
+
+	// Version 3 is understood by every Samba release that uses the NDR format
+	da := sambasecurity.DOSAttributes{
+		Version:    3,
+		ValidFlags: sambasecurity.DOSInfoAttrib,
+		Attrib:     uint32(attrib),
+	}
+	if crtime, ok := readCreationTime(n); ok {
+		da.ValidFlags |= sambasecurity.DOSInfoCreateTime
+		da.CreateTime = uint64(crtime)
+	}
+	return da.MarshalBinary()
+}
+
+// readCreationTime returns the NTFS creation time of the file, or false if
+// the underlying file system does not expose one. Older versions of ntfs-3g
+// only expose it as part of the full set of timestamps.
+func readCreationTime(n *mirrorfs.Node) (ntfs.Time, bool) {
+	if data, err := n.GetXAttr(ntfs.CreationTimeName, xattrSizeMax, 0); err == nil {
+		var crtime ntfs.Time
+		if crtime.UnmarshalBinary(data) == nil {
+			return crtime, true
+		}
+	}
+	if data, err := n.GetXAttr(ntfs.TimesName, xattrSizeMax, 0); err == nil {
+		var times ntfs.Times
+		if times.UnmarshalBinary(data) == nil {
+			return times.CreationTime, true
+		}
+	}
+	return 0, false
+}
+
+// writeCreationTime sets the NTFS creation time of the file, through the full
+// set of timestamps if ntfs-3g does not accept it on its own.
+func writeCreationTime(n *mirrorfs.Node, crtime ntfs.Time) error {
+	data, _ := crtime.MarshalBinary()
+	err := n.SetXAttr(ntfs.CreationTimeName, data, 0, 0)
+	if err == nil {
+		return nil
+	}
+	current, terr := n.GetXAttr(ntfs.TimesName, xattrSizeMax, 0)
+	if terr != nil {
+		return err
+	}
+	var times ntfs.Times
+	if times.UnmarshalBinary(current) != nil {
+		return err
+	}
+	times.CreationTime = crtime
+	data, _ = times.MarshalBinary()
+	return n.SetXAttr(ntfs.TimesName, data, 0, 0)
+}
+
+// writeDOSAttributes translates Samba DOS attribute data into NTFS file
+// attributes and a creation time, and applies them to the file. Members of
+// the data that have no NTFS equivalent are discarded.
+func writeDOSAttributes(n *mirrorfs.Node, data []byte) error {
+	var da sambasecurity.DOSAttributes
+	if err := da.UnmarshalBinary(data); err != nil {
+		return fuse.Errno(syscall.EINVAL)
+	}
+	if da.HasAttrib() {
+		// ntfs-3g ignores any flags that cannot be changed directly, such as
+		// the directory and compression flags
+		data, _ := ntfs.FileAttributes(da.Attrib).MarshalBinary()
+		if err := n.SetXAttr(ntfs.FileAttributesName, data, 0, 0); err != nil {
+			return err
+		}
+	}
+	if da.HasCreateTime() && da.CreateTime != 0 {
+		if err := writeCreationTime(n, ntfs.Time(da.CreateTime)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"syscall"
 
+	"go.scj.io/samba-over-ntfs/idmap"
 	"go.scj.io/samba-over-ntfs/mirrorfs"
 )
 
@@ -27,8 +28,24 @@ func main() {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, os.Kill, syscall.SIGQUIT)
 
+	flag.BoolVar(&mapStreams, "streams", false, "translate ntfs-3g stream attributes (streams_interface=xattr) for Samba's vfs_streams_xattr")
+	var links mirrorfs.LinkPolicy
+	flag.Var(&links, "links", "how to present symbolic links that point outside of SOURCEPATH (show|hide|rewrite)")
+	attrTTL := flag.Duration("attr-ttl", mirrorfs.DefaultAttrTTL, "how long the kernel may cache file attributes")
+	entryTTL := flag.Duration("entry-ttl", mirrorfs.DefaultEntryTTL, "how long the kernel may cache the results of name lookups")
+	watch := flag.Bool("watch", false, "watch SOURCEPATH for changes made other than through the mount and discard them from the kernel caches")
+	poll := flag.Duration("poll", mirrorfs.DefaultPollInterval, "with -watch, how often to check the files known to the kernel for changes that inotify cannot see, such as those made through another mount of the volume (0 disables)")
+	var mapping idmap.Chain
+	flag.Var(&mapping, "idmap", "present the owners of NTFS ACLs as uids and gids mapped by this backend; may be repeated to consult several backends in turn (rid:DOMAINSID:LOW-HIGH[:BASERID], autorid:LOW-HIGH[:RANGESIZE[:FILE]], static:FILE, alloc:LOW-HIGH[:FILE] or ntfs3g:VOLUME)")
+	flag.BoolVar(&aclMode, "acl-mode", false, "present permission bits computed from the NTFS ACL of each file for its owner, group and Everyone")
+	flag.BoolVar(&posixACLs, "posix-acls", false, "present POSIX ACLs (system.posix_acl_access and system.posix_acl_default) computed from the NTFS ACL of each file, naming the users and groups that -idmap maps")
+	flag.BoolVar(&synthesizeACLs, "synthesize-ntacl", false, "present a Samba ACL synthesized from the mode and POSIX ACLs of files that have no NTFS ACL, as Samba would derive it")
+	flag.BoolVar(&richACLs, "richacl", false, "present the NTFS ACL of each file as a richacl (system.richacl) and record richacls written to files in their NTFS ACLs; without -idmap, entries for domain SIDs are left out")
 	flag.Usage = usage
 	flag.Parse()
+	if len(mapping) > 0 {
+		idMapping = mapping
+	}
 
 	path := flag.Arg(0)
 	mountpoint := flag.Arg(1)
@@ -51,7 +68,21 @@ func main() {
 		}
 	}()
 
-	if err := mirrorfs.Mount(path, mountpoint, "samba-over-ntfs", "samba-over-ntfs", "samba-over-ntfs", NewFS); err != nil {
+	root, err := mirrorfs.New(path, NewNode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	root.Links = links
+	root.AttrTTL = *attrTTL
+	root.EntryTTL = *entryTTL
+	root.PollInterval = *poll
+	if *watch {
+		if err := root.Watch(); err != nil {
+			// The mount still works, only with the kernel caches alone
+			log.Printf("Not watching %s for changes: %v", path, err)
+		}
+	}
+	if err := mirrorfs.Serve(root, mountpoint, "samba-over-ntfs", "samba-over-ntfs", "samba-over-ntfs"); err != nil {
 		log.Fatal(err)
 	}
 }
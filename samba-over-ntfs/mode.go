@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+
+	"go.scj.io/samba-over-ntfs/mirrorfs"
+	"go.scj.io/samba-over-ntfs/posixsecurity"
+)
+
+// aclMode is set from the command line to present the permission bits of
+// files as computed from their NTFS ACLs rather than those reported by the
+// underlying file system, which are typically a mask applied to the whole
+// volume.
+var aclMode bool
+
+// modeCacheName is the name under which the presented permission bits of a
+// file are cached alongside its converted extended attributes.
+const modeCacheName = "mode"
+
+// readMode returns the permission bits that the DACL of the NTFS ACL of the
+// file grants to its owner, its group and everyone else. It returns false if
+// the file has no NTFS ACL.
+func readMode(n *mirrorfs.Node) (os.FileMode, bool) {
+	fi, err := n.Stat()
+	if err != nil {
+		return 0, false
+	}
+	if v, ok := sambaCache.get(fi, modeCacheName); ok {
+		return v.(os.FileMode), true
+	}
+	sd, ok := readNTFSACL(n)
+	if !ok {
+		return 0, false
+	}
+	perm := posixsecurity.Mode(sd)
+	sambaCache.put(fi, modeCacheName, perm)
+	return perm, true
+}
@@ -3,88 +3,218 @@ package main
 import (
 	"log"
 	"os"
-	"path/filepath"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	"golang.org/x/net/context"
 
 	"go.scj.io/samba-over-ntfs/mirrorfs"
-	"go.scj.io/samba-over-ntfs/sambasecurity"
 )
 
+// Node wraps the nodes of the mirrored file system to translate their
+// extended attributes for Samba.
 type Node struct {
-	mirrorfs.Node
+	*mirrorfs.Node
 }
 
-func NewNode(file *os.File) (Node, error) {
-	n, err := mirrorfs.NewNode(file)
-	return Node{n}, err
+// NewNode wraps a mirrorfs node. It is used as the wrapper of the mirrored
+// file system so that every node it returns is translated.
+func NewNode(n *mirrorfs.Node) fs.Node {
+	return Node{n}
 }
 
-// FS Methods
+// Node Methods
 
-var _ fs.FS = (*Node)(nil)
+var _ fs.Node = Node{}
 
-func (f Node) Root() (fs.Node, error) {
-	return f, nil
+func (n Node) Attr(ctx context.Context, a *fuse.Attr) error {
+	if err := n.Node.Attr(ctx, a); err != nil {
+		return err
+	}
+	if idMapping != nil {
+		if uid, gid, ok := readOwner(n.Node, a.Uid, a.Gid); ok {
+			a.Uid, a.Gid = uid, gid
+		}
+	}
+	if aclMode {
+		if perm, ok := readMode(n.Node); ok {
+			a.Mode = a.Mode&^os.ModePerm | perm
+		}
+	}
+	return nil
 }
 
-// Node Methods
+var _ = fs.NodeSetattrer(&Node{})
+
+func (n Node) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if idMapping != nil && (req.Valid.Uid() || req.Valid.Gid()) {
+		// Record the new owner in the NTFS ACL, which the owner is presented from
+		ok, err := writeOwner(n.Node, req)
+		if err != nil {
+			return err
+		}
+		if ok {
+			n.forgetXAttrs()
+			req.Valid &^= fuse.SetattrUid | fuse.SetattrGid
+		}
+	}
+	return n.Node.Setattr(ctx, req, resp)
+}
 
 var _ = fs.NodeGetxattrer(&Node{})
 
 func (n Node) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) (err error) {
-	log.Printf("%s GETXATTR: %s %v", n.Kind(), n.Name(), req)
-	xattr, err := mirrorfs.GetFileXAttr(n.File, req.Name, req.Size, req.Position)
-	if err == fuse.ErrNoXattr && req.Name == sambaXAttr {
+	log.Printf("%s GETXATTR: %s %v", n.Kind(), n.Path(), req)
+	if req.Name == dosXAttr {
+		// Synthesize the DOS attributes from their NTFS equivalents if they're
+		// available, since they are authoritative
+		if xattr, err := readDOSAttributes(n.Node); err == nil {
+			resp.Xattr, err = sizedXAttr(xattr, req.Size)
+			return err
+		}
+	}
+	if stream, ok := sambaToStream(req.Name); ok && mapStreams {
+		xattr, err := n.GetXAttr(stream, xattrSizeMax, req.Position)
+		if err != nil {
+			return err
+		}
+		resp.Xattr, err = sizedXAttr(streamToSambaValue(xattr), req.Size)
+		return err
+	}
+	if req.Name == sambaXAttr {
+		return n.getSambaACL(req, resp)
+	}
+	if posixACLs && isPOSIXACLXAttr(req.Name) {
+		return n.getPOSIXACL(req, resp)
+	}
+	if richACLs && req.Name == richACLXAttr {
+		return n.getRichACL(req, resp)
+	}
+	resp.Xattr, err = n.GetXAttr(req.Name, req.Size, req.Position)
+	return
+}
+
+// getSambaACL answers a request for the Samba ACL, which is converted from
+// the NTFS ACL unless the underlying file system stores a Samba ACL itself.
+// Samba requests the ACL on nearly every open, so converted ACLs are cached.
+func (n Node) getSambaACL(req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	fi, err := n.Stat()
+	if err != nil {
+		return err
+	}
+	if xattr, ok := sambaCache.get(fi, sambaXAttr); ok {
+		resp.Xattr, err = sizedXAttr(xattr.([]byte), req.Size)
+		return err
+	}
+	xattr, err := n.GetXAttr(sambaXAttr, req.Size, req.Position)
+	if err == fuse.ErrNoXattr {
 		// Substitute the converted NTFS ACL if it's available
-		xattr, err = mirrorfs.GetFileXAttr(n.File, ntfsXAttr, req.Size, req.Position)
-		if len(xattr) > 0 && err == nil {
-			if req.Size == 0 {
-				// By specifying a size of 0, the caller indicates that they only want the
-				// length of the xattr, not the xattr itself. This is typically used
-				// by the caller to allocate an appropriately sized block of memory.
-				//
-				// Allocating a chunk of memory like this for the sole purpose of having its
-				// length measureed later on in the API is a very poor way to communicate
-				// the length of the xattr, but that's what the bazil fuse library
-				// currently expects of us.
-				length := len(xattr) + sambasecurity.XAttrFixedBytes // Samba v1 simply prepends a header to the NTFS format
-				xattr, err = make([]byte, length), nil
-			} else {
-				// Convert the ACL from NTFS format to Samba format
-				xattr, err = convertXAttr(xattr)
+		acl, aclErr := n.GetXAttr(ntfsXAttr, xattrSizeMax, 0)
+		if aclErr == nil && len(acl) > 0 {
+			// The full ACL is converted even when only its length is requested,
+			// since Samba requests the ACL itself right afterwards
+			if xattr, err = convertXAttr(acl); err == nil {
+				sambaCache.put(fi, sambaXAttr, xattr)
+				xattr, err = sizedXAttr(xattr, req.Size)
+			}
+		} else if synthesizeACLs {
+			// Synthesize the ACL from the mode and POSIX ACLs instead
+			if xattr, err = synthesizeSambaACL(n.Node, fi); err == nil {
+				sambaCache.put(fi, sambaXAttr, xattr)
+				xattr, err = sizedXAttr(xattr, req.Size)
 			}
 		}
 	}
 	resp.Xattr = xattr
-	return
+	return err
+}
+
+// forgetXAttrs discards the cached attributes of the node when they may have
+// been changed.
+func (n Node) forgetXAttrs() {
+	if fi, err := n.Stat(); err == nil {
+		sambaCache.purge(fi)
+	}
 }
 
 var _ = fs.NodeListxattrer(&Node{})
 
 func (n Node) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) (err error) {
-	log.Printf("%s NEW LISTXATTR: %s %v", n.Kind(), n.Name(), req)
-	list, err := mirrorfs.ListFileXAttr(n.File, req.Size, req.Position)
+	log.Printf("%s NEW LISTXATTR: %s %v", n.Kind(), n.Path(), req)
+	list, err := n.ListXAttr(xattrSizeMax, req.Position)
 	if err != nil {
 		return
 	}
-	resp.Xattr, err = convertXAttrList(list, req.Size)
+	if mapStreams {
+		list = convertStreamXAttrList(list)
+	}
+	list = convertXAttrList(list)
+	if synthesizeACLs {
+		list = appendXAttrListEntry(list, sambaXAttr)
+	}
+	if hasNTFSAttributes(n.Node) {
+		list = appendXAttrListEntry(list, dosXAttr)
+	}
+	if posixACLs && hasXAttrListEntry(list, ntfsXAttr) {
+		list = appendPOSIXACLs(n.Node, list)
+	}
+	if richACLs && hasXAttrListEntry(list, ntfsXAttr) {
+		list = appendXAttrListEntry(list, richACLXAttr)
+	}
+	resp.Xattr, err = sizedXAttr(list, req.Size)
 	return
 }
 
-// Directory methods
+var _ = fs.NodeSetxattrer(&Node{})
+
+func (n Node) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) (err error) {
+	log.Printf("%s SETXATTR: %s %v", n.Kind(), n.Path(), req)
+	defer n.forgetXAttrs()
+	if req.Name == dosXAttr && hasNTFSAttributes(n.Node) {
+		// Translate the DOS attributes into their NTFS equivalents instead of
+		// storing a copy that could fall out of sync with them
+		return writeDOSAttributes(n.Node, req.Xattr)
+	}
+	if req.Name == sambaXAttr {
+		if existing, err := n.GetXAttr(ntfsXAttr, xattrSizeMax, 0); err == nil {
+			// Write the descriptor to the NTFS ACL, which remains authoritative
+			data, err := convertSambaXAttr(req.Xattr, existing)
+			if err != nil {
+				return err
+			}
+			return n.SetXAttr(ntfsXAttr, data, 0, 0)
+		}
+	}
+	if richACLs && req.Name == richACLXAttr {
+		// Record the richacl in the NTFS ACL, from which it is converted
+		if ok, err := writeRichACL(n.Node, req.Xattr); ok {
+			return err
+		}
+	}
+	if stream, ok := sambaToStream(req.Name); ok && mapStreams {
+		return n.SetXAttr(stream, sambaToStreamValue(req.Xattr), req.Flags, req.Position)
+	}
+	return n.SetXAttr(req.Name, req.Xattr, req.Flags, req.Position)
+}
 
-var _ = fs.NodeRequestLookuper(&Node{})
+var _ = fs.NodeRemovexattrer(&Node{})
 
-func (d Node) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
-	//fi, err := file.Stat()
-	path := filepath.Join(d.Name(), req.Name)
-	log.Printf("%s LOOKUP: %s : %s", d.Kind(), req.Name, path)
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, fuse.ENOENT // FIXME: Correct error response?
+func (n Node) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) (err error) {
+	log.Printf("%s REMOVEXATTR: %s %v", n.Kind(), n.Path(), req)
+	defer n.forgetXAttrs()
+	if req.Name == sambaXAttr || richACLs && req.Name == richACLXAttr {
+		if _, err := n.GetXAttr(ntfsXAttr, 0, 0); err == nil {
+			// The descriptor is derived from the NTFS ACL, which cannot be removed
+			return fuse.EPERM
+		}
 	}
-	return NewNode(file)
+	if stream, ok := sambaToStream(req.Name); ok && mapStreams {
+		return n.RemoveXAttr(stream)
+	}
+	err = n.RemoveXAttr(req.Name)
+	if err == fuse.ErrNoXattr && req.Name == dosXAttr && hasNTFSAttributes(n.Node) {
+		// The synthesized attribute has no stored copy to remove
+		err = nil
+	}
+	return
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bazil.org/fuse"
+
+	"go.scj.io/samba-over-ntfs/idmap"
+	"go.scj.io/samba-over-ntfs/mirrorfs"
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// idMapping maps the owners and groups of NTFS ACLs to uids and gids. When it
+// is set, files are presented as owned by the owner and group recorded in
+// their NTFS ACLs rather than those reported by the underlying file system,
+// and changes of ownership are recorded in the NTFS ACLs. It is set from the
+// command line.
+var idMapping idmap.Backend
+
+// ownerCacheName is the name under which the presented owner of a file is
+// cached alongside its converted extended attributes.
+const ownerCacheName = "owner"
+
+// owner is the uid and gid that a file is presented with.
+type owner struct {
+	uid uint32
+	gid uint32
+}
+
+// readOwner returns the uid and gid that the owner and group of the NTFS ACL
+// of the file map to, Unix user and group SIDs standing for their IDs. Where the ACL has no owner or group, or it cannot be
+// mapped, the given uid or gid is used instead. It returns false if the file
+// has no NTFS ACL.
+func readOwner(n *mirrorfs.Node, uid, gid uint32) (uint32, uint32, bool) {
+	fi, err := n.Stat()
+	if err != nil {
+		return 0, 0, false
+	}
+	if v, ok := sambaCache.get(fi, ownerCacheName); ok {
+		o := v.(owner)
+		return o.uid, o.gid, true
+	}
+	sd, ok := readNTFSACL(n)
+	if !ok {
+		return 0, 0, false
+	}
+	o := owner{uid: uid, gid: gid}
+	if sd.Owner != nil {
+		if id, err := idmap.ResolveSIDAs(idMapping, *sd.Owner, idmap.UserID); err == nil {
+			o.uid = id
+		}
+	}
+	if sd.Group != nil {
+		if id, err := idmap.ResolveSIDAs(idMapping, *sd.Group, idmap.GroupID); err == nil {
+			o.gid = id
+		}
+	}
+	sambaCache.put(fi, ownerCacheName, o)
+	return o.uid, o.gid, true
+}
+
+// writeOwner records the owner and group given by the request in the NTFS ACL
+// of the file, as Unix user and group SIDs where they are not mapped. It returns false if the file has no NTFS ACL.
+func writeOwner(n *mirrorfs.Node, req *fuse.SetattrRequest) (bool, error) {
+	data, err := n.GetXAttr(ntfsXAttr, xattrSizeMax, 0)
+	if err != nil {
+		return false, nil
+	}
+	var sd ntsecurity.SecurityDescriptor
+	if err := sd.UnmarshalBinary(data); err != nil {
+		return true, fuse.EIO
+	}
+	if req.Valid.Uid() {
+		sid := idmap.ResolveID(idMapping, req.Uid, idmap.UserID)
+		sd.Owner = &sid
+	}
+	if req.Valid.Gid() {
+		sid := idmap.ResolveID(idMapping, req.Gid, idmap.GroupID)
+		sd.Group = &sid
+	}
+	return true, writeNTFSACL(n, &sd)
+}
+
+// readNTFSACL returns the security descriptor stored in the NTFS ACL of the
+// file. It returns false if the file has no NTFS ACL or it cannot be read.
+func readNTFSACL(n *mirrorfs.Node) (*ntsecurity.SecurityDescriptor, bool) {
+	data, err := n.GetXAttr(ntfsXAttr, xattrSizeMax, 0)
+	if err != nil {
+		return nil, false
+	}
+	sd := new(ntsecurity.SecurityDescriptor)
+	if err := sd.UnmarshalBinary(data); err != nil {
+		return nil, false
+	}
+	return sd, true
+}
+
+// writeNTFSACL stores the security descriptor in the NTFS ACL of the file.
+func writeNTFSACL(n *mirrorfs.Node, sd *ntsecurity.SecurityDescriptor) error {
+	// ntfs-3g only accepts self-relative descriptors, and entries of an
+	// unknown type cannot be encoded
+	sd.Control |= ntsecurity.SelfRelative
+	sd.DACL = filterACL(sd.DACL)
+	sd.SACL = filterACL(sd.SACL)
+	data, err := sd.MarshalBinary()
+	if err != nil {
+		return fuse.EIO
+	}
+	return n.SetXAttr(ntfsXAttr, data, 0, 0)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"bazil.org/fuse"
+
+	"go.scj.io/samba-over-ntfs/mirrorfs"
+	"go.scj.io/samba-over-ntfs/posixsecurity"
+)
+
+// posixACLs is set from the command line to present POSIX ACLs computed
+// from the NTFS ACLs of files, for programs and Samba servers that
+// understand POSIX ACLs but not NT security descriptors.
+var posixACLs bool
+
+// synthesizeACLs is set from the command line to present Samba ACLs
+// synthesized from the mode and POSIX ACLs of files that have no NTFS ACL,
+// such as those of a source tree on a Linux file system.
+var synthesizeACLs bool
+
+// isPOSIXACLXAttr returns true if the name is that of a POSIX ACL.
+func isPOSIXACLXAttr(name string) bool {
+	return name == posixsecurity.AccessACLName || name == posixsecurity.DefaultACLName
+}
+
+// readPOSIXACL returns the POSIX ACL of the given name, in the format of its
+// extended attribute, that the NTFS ACL of the file projects onto. It returns
+// nil if the file has no such ACL, which is the case for the default ACL of a
+// file that is not a directory. It returns false if the file has no NTFS ACL.
+func readPOSIXACL(n *mirrorfs.Node, name string) ([]byte, bool) {
+	fi, err := n.Stat()
+	if err != nil {
+		return nil, false
+	}
+	if v, ok := sambaCache.get(fi, name); ok {
+		return v.([]byte), true
+	}
+	sd, ok := readNTFSACL(n)
+	if !ok {
+		return nil, false
+	}
+	var acl posixsecurity.ACL
+	if name == posixsecurity.AccessACLName {
+		acl = posixsecurity.AccessACL(sd, idMapping)
+	} else if fi.IsDir() {
+		acl = posixsecurity.DefaultACL(sd, idMapping)
+	}
+	var xattr []byte
+	if acl != nil {
+		xattr, _ = acl.MarshalBinary()
+	}
+	sambaCache.put(fi, name, xattr)
+	return xattr, true
+}
+
+// getPOSIXACL answers a request for a POSIX ACL, which is computed from the
+// NTFS ACL unless the file has none.
+func (n Node) getPOSIXACL(req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) (err error) {
+	xattr, ok := readPOSIXACL(n.Node, req.Name)
+	if !ok {
+		resp.Xattr, err = n.GetXAttr(req.Name, req.Size, req.Position)
+		return
+	}
+	if xattr == nil {
+		return fuse.ErrNoXattr
+	}
+	resp.Xattr, err = sizedXAttr(xattr, req.Size)
+	return
+}
+
+// appendPOSIXACLs returns the list with the names of the POSIX ACLs that the
+// NTFS ACL of the file projects onto appended to it.
+func appendPOSIXACLs(n *mirrorfs.Node, list []byte) []byte {
+	for _, name := range []string{posixsecurity.AccessACLName, posixsecurity.DefaultACLName} {
+		if xattr, ok := readPOSIXACL(n, name); ok && xattr != nil {
+			list = appendXAttrListEntry(list, name)
+		}
+	}
+	return list
+}
+
+// synthesizeSambaACL returns the Samba ACL that Samba would present for the
+// file described by fi, which is derived from its owner, group, mode and
+// POSIX ACLs.
+func synthesizeSambaACL(n *mirrorfs.Node, fi os.FileInfo) ([]byte, error) {
+	st := fi.Sys().(*syscall.Stat_t)
+	access := readStoredPOSIXACL(n, posixsecurity.AccessACLName)
+	var def posixsecurity.ACL
+	if fi.IsDir() {
+		def = readStoredPOSIXACL(n, posixsecurity.DefaultACLName)
+	}
+	sd := posixsecurity.SecurityDescriptor(st.Uid, st.Gid, fi.Mode(), access, def, idMapping)
+	return marshalSambaXAttr(sd)
+}
+
+// readStoredPOSIXACL returns the POSIX ACL of the given name that the
+// underlying file system stores for the file, or nil if it has none.
+func readStoredPOSIXACL(n *mirrorfs.Node, name string) posixsecurity.ACL {
+	data, err := n.GetXAttr(name, xattrSizeMax, 0)
+	if err != nil {
+		return nil
+	}
+	var acl posixsecurity.ACL
+	if err := acl.UnmarshalBinary(data); err != nil {
+		return nil
+	}
+	return acl
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"syscall"
+
+	"bazil.org/fuse"
+
+	"go.scj.io/samba-over-ntfs/mirrorfs"
+	"go.scj.io/samba-over-ntfs/nfs4security"
+)
+
+// richACLs is set from the command line to present the NTFS ACLs of files as
+// richacls, and to record richacls written to files in their NTFS ACLs.
+var richACLs bool
+
+const richACLXAttr = nfs4security.RichACLXAttrName
+
+// getRichACL answers a request for the richacl, which is converted from the
+// NTFS ACL unless the file has none.
+func (n Node) getRichACL(req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) (err error) {
+	fi, err := n.Stat()
+	if err != nil {
+		return err
+	}
+	if xattr, ok := sambaCache.get(fi, richACLXAttr); ok {
+		resp.Xattr, err = sizedXAttr(xattr.([]byte), req.Size)
+		return err
+	}
+	sd, ok := readNTFSACL(n.Node)
+	if !ok {
+		resp.Xattr, err = n.GetXAttr(req.Name, req.Size, req.Position)
+		return
+	}
+	acl, dropped := nfs4security.RichACLFromSecurityDescriptor(sd, idMapping)
+	for _, ace := range dropped {
+		log.Printf("%s: Leaving access control entry %s out of the richacl", n.Path(), ace.SDDL())
+	}
+	xattr, err := acl.MarshalBinary()
+	if err != nil {
+		return fuse.EIO
+	}
+	sambaCache.put(fi, richACLXAttr, xattr)
+	resp.Xattr, err = sizedXAttr(xattr, req.Size)
+	return
+}
+
+// writeRichACL records the richacl in the NTFS ACL of the file, which keeps
+// its owner, group and SACL, and the entries of its DACL that getRichACL
+// leaves out. It returns false if the file has no NTFS ACL.
+func writeRichACL(n *mirrorfs.Node, data []byte) (bool, error) {
+	sd, ok := readNTFSACL(n)
+	if !ok {
+		return false, nil
+	}
+	var acl nfs4security.RichACL
+	if err := acl.UnmarshalBinary(data); err != nil {
+		return true, fuse.Errno(syscall.EINVAL)
+	}
+	if sd.Owner == nil || sd.Group == nil {
+		// ntfs-3g rejects descriptors without them
+		return true, fuse.Errno(syscall.EINVAL)
+	}
+	return true, writeNTFSACL(n, acl.UpdateSecurityDescriptor(sd, idMapping))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ntfs-3g mounted with streams_interface=xattr exposes the named data streams
+// of a file as user.<stream> extended attributes, while Samba's
+// vfs_streams_xattr module expects them as user.DosStream.<stream>:$DATA with
+// a trailing null byte appended to the stream data.
+const (
+	ntfsStreamPrefix  = "user."
+	sambaStreamPrefix = "user.DosStream."
+	sambaStreamSuffix = ":$DATA"
+)
+
+// mapStreams determines whether stream attributes are translated. It is set
+// from the command line.
+var mapStreams bool
+
+// reservedStreamNames are user attributes that Samba manages itself, which
+// are never treated as streams.
+var reservedStreamNames = map[string]bool{
+	"DOSATTRIB": true,
+	"SAMBA_PAI": true,
+}
+
+// streamToSamba returns the Samba name for an ntfs-3g stream attribute. It
+// returns false if the attribute is not a stream.
+func streamToSamba(name string) (string, bool) {
+	if !strings.HasPrefix(name, ntfsStreamPrefix) || strings.HasPrefix(name, sambaStreamPrefix) {
+		return "", false
+	}
+	stream := name[len(ntfsStreamPrefix):]
+	if stream == "" || reservedStreamNames[stream] {
+		return "", false
+	}
+	return sambaStreamPrefix + stream + sambaStreamSuffix, true
+}
+
+// sambaToStream returns the ntfs-3g attribute name for a Samba stream
+// attribute. It returns false if the attribute is not a stream.
+func sambaToStream(name string) (string, bool) {
+	if !strings.HasPrefix(name, sambaStreamPrefix) || !strings.HasSuffix(name, sambaStreamSuffix) {
+		return "", false
+	}
+	stream := name[len(sambaStreamPrefix) : len(name)-len(sambaStreamSuffix)]
+	if stream == "" || strings.ContainsRune(stream, ':') || reservedStreamNames[stream] {
+		return "", false
+	}
+	return ntfsStreamPrefix + stream, true
+}
+
+// convertStreamXAttrList replaces the names of ntfs-3g stream attributes in
+// the list with their Samba equivalents.
+func convertStreamXAttrList(data []byte) []byte {
+	var out []byte
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if len(entry) == 0 {
+			continue
+		}
+		name := string(entry)
+		if sambaName, ok := streamToSamba(name); ok {
+			name = sambaName
+		}
+		out = append(append(out, name...), 0)
+	}
+	return out
+}
+
+// streamToSambaValue returns the stream data in the form expected by Samba.
+func streamToSambaValue(data []byte) []byte {
+	return append(data, 0)
+}
+
+// sambaToStreamValue returns the stream data without the trailing null byte
+// appended by Samba.
+func sambaToStreamValue(data []byte) []byte {
+	if n := len(data); n > 0 && data[n-1] == 0 {
+		return data[:n-1]
+	}
+	return data
+}
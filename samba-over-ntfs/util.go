@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"log"
+	"syscall"
 
 	"bazil.org/fuse"
 	"go.scj.io/samba-over-ntfs/ntsecurity"
@@ -13,50 +15,71 @@ const (
 	sambaXAttr = "security.NTACL"
 )
 
-const (
-	ntfsXAttrListEntry        = ntfsXAttr + "\x00"
-	sambaXAttrListEntry       = sambaXAttr + "\x00"
-	ntfsXAttrListEntryLength  = len(ntfsXAttrListEntry)
-	sambaXAttrListEntryLength = len(sambaXAttrListEntry)
-)
+// xattrSizeMax is the largest extended attribute value or list that Linux
+// will transfer, which is used when the full value is needed regardless of
+// the size requested by the caller.
+const xattrSizeMax = 65536
+
+// sizedXAttr applies the size semantics of getxattr and listxattr to the
+// given attribute data.
+func sizedXAttr(data []byte, size uint32) ([]byte, error) {
+	if size == 0 {
+		// By specifying a size of 0, the caller indicates that they only want the
+		// length of the data, not the data itself. Bazil measures the length of
+		// the returned slice.
+		return make([]byte, len(data)), nil
+	}
+	if len(data) > int(size) {
+		return nil, fuse.ERANGE
+	}
+	return data, nil
+}
 
-var ntfsXAttrListEntryBytes = []byte(ntfsXAttrListEntry)
-var sambaXAttrListEntryBytes = []byte(sambaXAttrListEntry)
+// hasXAttrListEntry returns true if the list contains the given name.
+func hasXAttrListEntry(data []byte, name string) bool {
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if string(entry) == name {
+			return true
+		}
+	}
+	return false
+}
 
-// convertFlistxattr inspects the data to determine whether an NTFS ACL is
+// appendXAttrListEntry returns the list with the given name appended to it,
+// unless it is already present.
+func appendXAttrListEntry(data []byte, name string) []byte {
+	if hasXAttrListEntry(data, name) {
+		return data
+	}
+	return append(append(data, name...), 0)
+}
+
+// convertXAttrList inspects the data to determine whether an NTFS ACL is
 // present, and if so returns a modified list that also includes a Samba ACL
 // appended to the end.
-func convertXAttrList(data []byte, size uint32) ([]byte, error) {
+func convertXAttrList(data []byte) []byte {
 	// FIXME: If the order of items in the list matters reorder the elements after
 	// appending the Samba ACL
-
-	/*
-		if len(data) > 0 {
-			log.Printf("XAttrs list is not empty")
-		} else {
-			log.Printf("XAttrs list is empty")
-		}
-	*/
-	if bytes.Contains(data, ntfsXAttrListEntryBytes) && !bytes.Contains(data, sambaXAttrListEntryBytes) {
-		newLength := len(data) + sambaXAttrListEntryLength
-		if newLength > int(size) {
-			return nil, fuse.ERANGE
-		}
-		return append(data, sambaXAttrListEntry...), nil
+	if hasXAttrListEntry(data, ntfsXAttr) {
+		return appendXAttrListEntry(data, sambaXAttr)
 	}
-	return data, nil
+	return data
 }
 
 func convertXAttr(data []byte) ([]byte, error) {
 	var sd ntsecurity.SecurityDescriptor
-	var xa sambasecurity.SecurityDescriptor
 
 	err := sd.UnmarshalBinary(data)
 	if err != nil {
 		return nil, fuse.ErrNoXattr
 	}
+	return marshalSambaXAttr(&sd)
+}
 
-	xa.SecurityDescriptor = &sd
+// marshalSambaXAttr encodes the security descriptor as a Samba ACL.
+func marshalSambaXAttr(sd *ntsecurity.SecurityDescriptor) ([]byte, error) {
+	var xa sambasecurity.SecurityDescriptor
+	xa.SecurityDescriptor = sd
 	xa.Version = 1
 	output, err := xa.MarshalBinary()
 	if err != nil {
@@ -64,3 +87,63 @@ func convertXAttr(data []byte) ([]byte, error) {
 	}
 	return output, nil
 }
+
+// convertSambaXAttr converts Samba security descriptor data into the format
+// expected by ntfs-3g. The existing NTFS security descriptor of the file, if
+// any, supplies the owner and group when the Samba descriptor lacks them,
+// since ntfs-3g rejects descriptors without them.
+func convertSambaXAttr(data []byte, existing []byte) ([]byte, error) {
+	var xa sambasecurity.SecurityDescriptor
+	if err := xa.UnmarshalBinary(data); err != nil || xa.SecurityDescriptor == nil {
+		return nil, fuse.Errno(syscall.EINVAL)
+	}
+	sd := xa.SecurityDescriptor
+
+	if sd.Owner == nil || sd.Group == nil {
+		var current ntsecurity.SecurityDescriptor
+		if len(existing) > 0 && current.UnmarshalBinary(existing) == nil {
+			if sd.Owner == nil {
+				sd.Owner = current.Owner
+			}
+			if sd.Group == nil {
+				sd.Group = current.Group
+			}
+		}
+		if sd.Owner == nil || sd.Group == nil {
+			return nil, fuse.Errno(syscall.EINVAL)
+		}
+	}
+
+	// ntfs-3g only accepts self-relative descriptors, and entries of an
+	// unknown type cannot be encoded
+	sd.Control |= ntsecurity.SelfRelative
+	sd.DACL = filterACL(sd.DACL)
+	sd.SACL = filterACL(sd.SACL)
+
+	output, err := sd.MarshalBinary()
+	if err != nil {
+		return nil, fuse.Errno(syscall.EINVAL)
+	}
+	return output, nil
+}
+
+// filterACL removes access control entries of unknown types from the list.
+func filterACL(acl *ntsecurity.ACL) *ntsecurity.ACL {
+	if acl == nil {
+		return nil
+	}
+	entries := acl.Entries[:0]
+	for _, ace := range acl.Entries {
+		switch ace.Type {
+		case ntsecurity.AccessAllowedControl, ntsecurity.AccessDeniedControl,
+			ntsecurity.SystemAuditControl, ntsecurity.SystemAlarmControl,
+			ntsecurity.AccessAllowedObjectControl, ntsecurity.AccessDeniedObjectControl,
+			ntsecurity.SystemAuditObjectControl, ntsecurity.SystemAlarmObjectControl:
+			entries = append(entries, ace)
+		default:
+			log.Printf("Discarding access control entry of unsupported type %d", ace.Type)
+		}
+	}
+	acl.Entries = entries
+	return acl
+}
@@ -0,0 +1,204 @@
+package sambasecurity
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.scj.io/samba-over-ntfs/ndr"
+)
+
+const (
+	// DOSAttributesName is the name of the extended attribute in which Samba
+	// stores DOS file attributes and creation times.
+	DOSAttributesName = "user.DOSATTRIB"
+
+	// DOSAttributesCompatVersion identifies attribute data that consists of
+	// the hexadecimal attribute string alone, as written by early releases of
+	// Samba 3.
+	DOSAttributesCompatVersion = 0xFFFF
+)
+
+// DOSInfoValidFlags indicates which members of version 3 and later DOS
+// attribute data contain meaningful values.
+type DOSInfoValidFlags uint32
+
+const (
+	DOSInfoAttrib     DOSInfoValidFlags = 0x00000001
+	DOSInfoEASize     DOSInfoValidFlags = 0x00000002
+	DOSInfoSize       DOSInfoValidFlags = 0x00000004
+	DOSInfoAllocSize  DOSInfoValidFlags = 0x00000008
+	DOSInfoCreateTime DOSInfoValidFlags = 0x00000010
+	DOSInfoChangeTime DOSInfoValidFlags = 0x00000020
+	DOSInfoITime      DOSInfoValidFlags = 0x00000040
+)
+
+// HasFlag returns true if the valid flags contain the given flag, otherwise it
+// returns false.
+func (f DOSInfoValidFlags) HasFlag(flag DOSInfoValidFlags) bool {
+	return f&flag == flag
+}
+
+// DOSAttributes is the decoded form of the user.DOSATTRIB extended attribute.
+//
+// Version determines which of the remaining members are encoded. Times are
+// expressed as NTTIME values.
+//
+// See the definition of xattr_DOSATTRIB in samba/librpc/idl/xattr.idl
+type DOSAttributes struct {
+	Version    uint16
+	ValidFlags DOSInfoValidFlags // Versions 3 and later
+	Flags      uint32            // Version 2
+	Attrib     uint32
+	EASize     uint32 // Versions 1 through 3
+	Size       uint64 // Versions 1 through 3
+	AllocSize  uint64 // Versions 1 through 3
+	ITime      uint64 // Version 4
+	CreateTime uint64
+	ChangeTime uint64 // Versions 1 through 3
+	WriteTime  uint64 // Version 2
+	Name       string // Version 2
+}
+
+// HasAttrib returns true if the attribute data includes the DOS file
+// attributes.
+func (a *DOSAttributes) HasAttrib() bool {
+	return a.Version < 3 || a.Version == DOSAttributesCompatVersion || a.ValidFlags.HasFlag(DOSInfoAttrib)
+}
+
+// HasCreateTime returns true if the attribute data includes a creation time.
+func (a *DOSAttributes) HasCreateTime() bool {
+	switch a.Version {
+	case 1, 2:
+		return true
+	case 3, 4, 5:
+		return a.ValidFlags.HasFlag(DOSInfoCreateTime)
+	default:
+		return false
+	}
+}
+
+// MarshalBinary writes the DOS attributes according to a Samba NDR data
+// layout.
+func (a *DOSAttributes) MarshalBinary() (data []byte, err error) {
+	e := ndr.NewEncoder()
+
+	// Samba always leads with the attributes as a hexadecimal string so that
+	// the value remains readable by releases that predate the NDR encoding
+	e.NullTermString(fmt.Sprintf("0x%x", a.Attrib))
+	if a.Version == DOSAttributesCompatVersion {
+		return e.Bytes(), nil
+	}
+
+	e.Uint16(a.Version)
+	e.Uint16(a.Version)
+	switch a.Version {
+	case 1:
+		e.Uint32(a.Attrib)
+		e.Uint32(a.EASize)
+		e.Udlong(a.Size)
+		e.Udlong(a.AllocSize)
+		e.Udlong(a.CreateTime)
+		e.Udlong(a.ChangeTime)
+	case 2:
+		e.Uint32(a.Flags)
+		e.Uint32(a.Attrib)
+		e.Uint32(a.EASize)
+		e.Udlong(a.Size)
+		e.Udlong(a.AllocSize)
+		e.Udlong(a.CreateTime)
+		e.Udlong(a.ChangeTime)
+		e.Udlong(a.WriteTime)
+		e.NullTermString(a.Name)
+	case 3:
+		e.Uint32(uint32(a.ValidFlags))
+		e.Uint32(a.Attrib)
+		e.Uint32(a.EASize)
+		e.Udlong(a.Size)
+		e.Udlong(a.AllocSize)
+		e.Udlong(a.CreateTime)
+		e.Udlong(a.ChangeTime)
+	case 4:
+		e.Uint32(uint32(a.ValidFlags))
+		e.Uint32(a.Attrib)
+		e.Udlong(a.ITime)
+		e.Udlong(a.CreateTime)
+	case 5:
+		e.Uint32(uint32(a.ValidFlags))
+		e.Uint32(a.Attrib)
+		e.Udlong(a.CreateTime)
+	default:
+		return nil, errors.New("Unknown Samba DOS attribute version")
+	}
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary reads DOS attributes from a byte slice containing
+// user.DOSATTRIB attribute data formatted according to a Samba NDR data
+// layout.
+func (a *DOSAttributes) UnmarshalBinary(data []byte) (err error) {
+	d := ndr.NewDecoder(data)
+	hex := d.NullTermString()
+	if err = d.Err(); err != nil {
+		return
+	}
+
+	*a = DOSAttributes{}
+	if len(d.Remaining()) == 0 {
+		// Only the hexadecimal string is present
+		attrib, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(hex), "0x"), 16, 32)
+		if err != nil {
+			return errors.New("Invalid Samba DOS attribute data")
+		}
+		a.Version = DOSAttributesCompatVersion
+		a.Attrib = uint32(attrib)
+		return nil
+	}
+
+	a.Version = d.Uint16()
+	if level := d.Uint16(); d.Err() == nil && level != a.Version {
+		return errors.New("Invalid Samba DOS attribute data")
+	}
+	switch a.Version {
+	case 1:
+		a.Attrib = d.Uint32()
+		a.EASize = d.Uint32()
+		a.Size = d.Udlong()
+		a.AllocSize = d.Udlong()
+		a.CreateTime = d.Udlong()
+		a.ChangeTime = d.Udlong()
+	case 2:
+		a.Flags = d.Uint32()
+		a.Attrib = d.Uint32()
+		a.EASize = d.Uint32()
+		a.Size = d.Udlong()
+		a.AllocSize = d.Udlong()
+		a.CreateTime = d.Udlong()
+		a.ChangeTime = d.Udlong()
+		a.WriteTime = d.Udlong()
+		a.Name = d.NullTermString()
+	case 3:
+		a.ValidFlags = DOSInfoValidFlags(d.Uint32())
+		a.Attrib = d.Uint32()
+		a.EASize = d.Uint32()
+		a.Size = d.Udlong()
+		a.AllocSize = d.Udlong()
+		a.CreateTime = d.Udlong()
+		a.ChangeTime = d.Udlong()
+	case 4:
+		a.ValidFlags = DOSInfoValidFlags(d.Uint32())
+		a.Attrib = d.Uint32()
+		a.ITime = d.Udlong()
+		a.CreateTime = d.Udlong()
+	case 5:
+		a.ValidFlags = DOSInfoValidFlags(d.Uint32())
+		a.Attrib = d.Uint32()
+		a.CreateTime = d.Udlong()
+	default:
+		if d.Err() == nil {
+			return errors.New("Unknown Samba DOS attribute version")
+		}
+	}
+	return d.Err()
+}
@@ -1,8 +1,11 @@
 package sambasecurity
 
 import (
+	"crypto/md5"
 	"crypto/sha256"
 	"errors"
+
+	"go.scj.io/samba-over-ntfs/ndr"
 )
 
 const (
@@ -10,89 +13,111 @@ const (
 )
 
 const (
-	XAttrFixedBytes                = 2 + 2 + 4
-	SecurityDescriptorV4FixedBytes = 4 + 2 + 64 + 1 + 8 + 64 // Does not include description, but includes description terminator
-	SecurityDescriptorV3FixedBytes = 4 + 2 + 64
-	SecurityDescriptorV2FixedBytes = 0
+	// XAttrFixedBytes is the size of the xattr_NTACL header that precedes the
+	// version-specific data: the version, the union discriminant and the
+	// unique pointer referent.
+	XAttrFixedBytes = 2 + 2 + 4
 )
 
+// MarshalBinary writes the security descriptor as system.NTACL attribute
+// data formatted according to a Samba NDR data layout.
 func (sd *SecurityDescriptor) MarshalBinary() (data []byte, err error) {
-	data = make([]byte, sd.BinaryLength())
-	err = sd.PutBinary(data)
-	return
+	e := ndr.NewEncoder()
+	if err = sd.encode(e); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
 }
 
+// PutBinary writes the security descriptor to the given byte slice, which
+// must be at least BinaryLength() bytes long.
 func (sd *SecurityDescriptor) PutBinary(data []byte) (err error) {
-	// TODO: Take the version to write as a parameter? Or store the desired version in SambaSecDescXAttr?
-	// Note: Version 1 is for NT-only ACLs that are *not* based on a posix ACL
-	// Note: Version 2 is generally not used
-	// Note: Version 3 is for NT-only ACLs that are *not* based on a posix ACL (includes hash of NT descriptor)
-	// Note: Version 4 is for posix ACLs that have been translated into an NT equivalent (includes hash of NT descriptor and posix ACL)
-	attr := NativeXAttr(data)
-
-	attr.SetVersion(sd.Version)
-	if sd == nil {
-		attr.SetSecurityDescriptorPresence(false)
+	b, err := sd.MarshalBinary()
+	if err != nil {
 		return
 	}
-	attr.SetSecurityDescriptorPresence(true)
+	if len(b) > len(data) {
+		return errors.New("Insufficient space to encode Samba XAttr NTACL data")
+	}
+	copy(data, b)
+	return
+}
 
-	offset1 := attr.SecurityDescriptorOffset()
-	offset2 := uint32(0)
+// BinaryLength returns the number of bytes required to encode the security
+// descriptor.
+func (sd *SecurityDescriptor) BinaryLength() (size uint32) {
+	e := ndr.NewEncoder()
+	if err := sd.encode(e); err != nil {
+		return 0
+	}
+	return uint32(e.Len())
+}
 
-	switch sd.Version {
-	case 4:
-		n := NativeSecurityDescriptorHashV4(data[offset1:])
-		n.SetSecurityDescriptorPresence(true)
-		n.SetHashType(XAttrSDHashTypeSha256)
-		n.SetDescription(XAttrDescription)
-		offset2 = n.SecurityDescriptorOffset()
-	case 3:
-		n := NativeSecurityDescriptorHashV3(data[offset1:])
-		n.SetSecurityDescriptorPresence(true)
-		n.SetHashType(XAttrSDHashTypeSha256)
-		offset2 = n.SecurityDescriptorOffset()
-	case 2:
-		n := NativeSecurityDescriptorHashV2(data[offset1:])
-		n.SetSecurityDescriptorPresence(true)
-		offset2 = n.SecurityDescriptorOffset()
-	case 1:
-		n := NativeSecurityDescriptorHashV1(data[offset1:])
-		offset2 = n.SecurityDescriptorOffset()
-	default:
+func (sd *SecurityDescriptor) encode(e *ndr.Encoder) (err error) {
+	if sd.Version < 1 || sd.Version > 4 {
 		return errors.New("Unknown Samba XAttr NTACL Version")
 	}
 
-	if err = sd.SecurityDescriptor.PutBinary(data, offset1+offset2); err != nil {
+	// The NT descriptor is carried as an opaque structure. Its relative
+	// offsets are measured from its own start, so it is encoded on its own.
+	var blob []byte
+	if sd.SecurityDescriptor != nil {
+		if blob, err = sd.SecurityDescriptor.MarshalBinary(); err != nil {
+			return
+		}
+	}
+
+	// xattr_NTACL scalars: the version and the union discriminant, followed
+	// by a unique pointer to the version-specific arm of the union
+	e.Uint16(sd.Version)
+	e.Uint16(sd.Version)
+	if sd.Version == 1 {
+		e.UniquePtr(blob != nil)
+		encodeBlob(e, blob)
 		return
 	}
+	e.UniquePtr(true)
 
+	// security_descriptor_hash_v* scalars
+	e.UniquePtr(blob != nil)
 	switch sd.Version {
-	case 4:
-		n := NativeSecurityDescriptorHashV4(data[offset1:])
-		hash := sha256.Sum256(data) // FIXME: Produce a V3 hash
-		n.SetHash(hash[:])
-	case 3:
-		n := NativeSecurityDescriptorHashV3(data[offset1:])
-		hash := sha256.Sum256(data)
-		n.SetHash(hash[:])
+	case 2:
+		hash := sd.Hash
+		if len(hash) == 0 && blob != nil {
+			sum := md5.Sum(blob)
+			hash = sum[:]
+		}
+		e.FixedArray(hash, XAttrSDHashV2Size)
+	case 3, 4:
+		hashType, hash := sd.HashType, sd.Hash
+		if len(hash) == 0 && blob != nil {
+			sum := sha256.Sum256(blob)
+			hashType, hash = XAttrSDHashTypeSha256, sum[:]
+		}
+		e.Uint16(hashType)
+		e.FixedArray(hash, XAttrSDHashSize)
+		if sd.Version == 4 {
+			description := sd.Description
+			if description == "" {
+				description = XAttrDescription
+			}
+			e.NullTermString(description)
+			e.Udlong(sd.Time)
+			e.FixedArray(sd.SysACLHash, XAttrSDHashSize)
+		}
 	}
+
+	// security_descriptor_hash_v* buffers
+	encodeBlob(e, blob)
 	return
 }
 
-func (sd *SecurityDescriptor) BinaryLength() (size uint32) {
-	size = XAttrFixedBytes
-	if sd != nil {
-		switch sd.Version {
-		case 4:
-			size += uint32(SecurityDescriptorV4FixedBytes)
-			size += uint32(len(XAttrDescription))
-		case 3:
-			size += uint32(SecurityDescriptorV3FixedBytes)
-		case 2:
-			size += uint32(SecurityDescriptorV2FixedBytes)
-		}
-		size += sd.SecurityDescriptor.BinaryLength()
+// encodeBlob writes the deferred security descriptor referred to by a unique
+// pointer.
+func encodeBlob(e *ndr.Encoder, blob []byte) {
+	if blob == nil {
+		return
 	}
-	return
+	e.Align(4)
+	e.Raw(blob)
 }
@@ -1,9 +1,14 @@
 package sambasecurity
 
-import "go.scj.io/samba-over-ntfs/ntsecurity"
+import (
+	"crypto/sha256"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
 
 const (
-	XAttrSDHashSize = 64
+	XAttrSDHashSize   = 64
+	XAttrSDHashV2Size = 16
 )
 
 const (
@@ -11,31 +16,59 @@ const (
 	XAttrSDHashTypeSha256 = 1
 )
 
-type SambaSecDescHeader struct {
-	Version uint16
-}
-
+// SecurityDescriptor is the decoded form of a Samba xattr_NTACL structure.
+//
+// Version determines which of the remaining members are encoded. Version 1
+// contains the security descriptor alone and version 2, which is generally
+// not used, adds a 16-byte hash. Version 3 is for NT-only ACLs and adds a hash
+// of the NT descriptor, while version 4 is for posix ACLs that have been
+// translated into an NT equivalent and adds a hash of the posix ACL as well.
+//
+// See the definition of xattr_NTACL in samba/librpc/idl/xattr.idl
 type SecurityDescriptor struct {
 	Version uint16
 	*ntsecurity.SecurityDescriptor
-}
 
-type SambaSecDescV4 struct {
-	SambaSecDescV3
+	// HashType identifies the algorithm used to produce Hash. It is only
+	// encoded by versions 3 and 4.
+	HashType uint16
+
+	// Hash is a hash of an encoded NT security descriptor. It is encoded by
+	// versions 2 through 4. If it is empty when the descriptor is marshaled
+	// then it is computed from the stored descriptor.
+	//
+	// Samba hashes the descriptor that it derives from the file system rather
+	// than the stored one, and ignores the stored descriptor if that no
+	// longer hashes the same, so a computed hash only matches when the two
+	// descriptors are equal. HashSecurityDescriptor computes the hash of
+	// versions 3 and 4 from the derived descriptor.
+	Hash []byte
+
+	// Description identifies the entity that produced the hash. It is only
+	// encoded by version 4. If it is empty when the descriptor is marshaled
+	// then XAttrDescription is used.
 	Description string
-	Time        uint64
-	SysACLHash  [XAttrSDHashSize]uint8
-}
 
-type SambaSecDescV3 struct {
-	SambaSecDescV1
-	HashType uint16
-	Hash     [XAttrSDHashSize]uint8
-}
+	// Time is the last time the security descriptor was modified, expressed
+	// as an NTTIME. It is only encoded by version 4.
+	Time uint64
 
-type SambaSecDescV2 struct {
-	SambaSecDescV1
-	Hash [16]uint8
+	// SysACLHash is a hash of the posix ACL the NT descriptor was derived
+	// from. It is only encoded by version 4, and is never computed.
+	SysACLHash []byte
 }
 
-type SambaSecDescV1 ntsecurity.SecurityDescriptor
+// HashSecurityDescriptor returns the hash that Samba stores in versions 3 and
+// 4 for the security descriptor, which is the SHA-256 of its self-relative
+// encoding padded to XAttrSDHashSize. See hash_sd_sha256 in
+// samba/source3/modules/vfs_acl_common.c
+func HashSecurityDescriptor(sd *ntsecurity.SecurityDescriptor) ([]byte, error) {
+	blob, err := sd.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	hash := make([]byte, XAttrSDHashSize)
+	sum := sha256.Sum256(blob)
+	copy(hash, sum[:])
+	return hash, nil
+}
@@ -3,42 +3,55 @@ package sambasecurity
 import (
 	"errors"
 
+	"go.scj.io/samba-over-ntfs/ndr"
 	"go.scj.io/samba-over-ntfs/ntsecurity"
 )
 
 // UnmarshalBinary reads a security descriptor from a byte slice containing
 // system.NTACL attribute data formatted according to a Samba NDR data layout.
 func (sd *SecurityDescriptor) UnmarshalBinary(data []byte) (err error) {
-	attr := NativeXAttr(data)
-	//fmt.Printf("%d %d %x %d\n", n.Version(), n.VersionNDR(), b[4:8], n.SecurityDescriptorOffset())
-	if !attr.Valid() {
+	d := ndr.NewDecoder(data)
+
+	version := d.Uint16()
+	if level := d.Uint16(); d.Err() == nil && level != version {
 		return errors.New("Invalid Samba XAttr Security Descriptor Data")
 	}
+	present := d.UniquePtr()
+	if err = d.Err(); err != nil {
+		return
+	}
 
-	sd.Version = attr.Version()
-	present := attr.ContainsSecurityDescriptor()
-	offset := attr.SecurityDescriptorOffset()
+	sd.Version = version
+	sd.HashType = XAttrSDHashTypeNone
+	sd.Hash = nil
+	sd.Description = ""
+	sd.Time = 0
+	sd.SysACLHash = nil
 
 	if present {
-		switch sd.Version {
+		switch version {
 		case 4:
-			n := NativeSecurityDescriptorHashV4(data[offset:])
-			present = n.ContainsSecurityDescriptor()
-			offset += n.SecurityDescriptorOffset()
+			present = d.UniquePtr()
+			sd.HashType = d.Uint16()
+			sd.Hash = d.FixedArray(XAttrSDHashSize)
+			sd.Description = d.NullTermString()
+			sd.Time = d.Udlong()
+			sd.SysACLHash = d.FixedArray(XAttrSDHashSize)
 		case 3:
-			n := NativeSecurityDescriptorHashV3(data[offset:])
-			present = n.ContainsSecurityDescriptor()
-			offset += n.SecurityDescriptorOffset()
+			present = d.UniquePtr()
+			sd.HashType = d.Uint16()
+			sd.Hash = d.FixedArray(XAttrSDHashSize)
 		case 2:
-			n := NativeSecurityDescriptorHashV2(data[offset:])
-			present = n.ContainsSecurityDescriptor()
-			offset += n.SecurityDescriptorOffset()
+			present = d.UniquePtr()
+			sd.Hash = d.FixedArray(XAttrSDHashV2Size)
 		case 1:
-			n := NativeSecurityDescriptorHashV1(data[offset:])
-			offset += n.SecurityDescriptorOffset()
 		default:
 			return errors.New("Unknown Samba XAttr NTACL Version")
 		}
+		d.Align(4)
+		if err = d.Err(); err != nil {
+			return
+		}
 	}
 
 	if !present {
@@ -53,6 +66,5 @@ func (sd *SecurityDescriptor) UnmarshalBinary(data []byte) (err error) {
 		sd.SecurityDescriptor = new(ntsecurity.SecurityDescriptor)
 	}
 
-	sd.SecurityDescriptor.UnmarshalBinaryOffset(data, offset)
-	return
+	return sd.SecurityDescriptor.UnmarshalBinary(d.Remaining())
 }
@@ -6,6 +6,12 @@ import (
 	"go.scj.io/samba-over-ntfs/ntsecurity"
 )
 
+const (
+	// AttributeName is the name of the extended attribute containing Samba
+	// encoded security descriptor data
+	AttributeName = "security.NTACL"
+)
+
 // ReadFileSD will return the security descriptor for the requested file
 func ReadFileSD(path string) (*ntsecurity.SecurityDescriptor, error) {
 	bytes, err := ReadFileRawSD(path)
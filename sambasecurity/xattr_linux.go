@@ -3,10 +3,7 @@ package sambasecurity
 import "syscall"
 
 const (
-	// AttributeName is the name of the extended attribute containing Samba
-	// encoded security descriptor data
-	AttributeName = "security.NTACL"
-	xattrReplace  = 0 // FIXME: we don't know what this value should be
+	xattrReplace = 0 // FIXME: we don't know what this value should be
 )
 
 // ReadFileRawSD will return the raw security descriptor bytes for the requested
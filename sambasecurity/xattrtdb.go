@@ -0,0 +1,250 @@
+package sambasecurity
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"go.scj.io/samba-over-ntfs/ndr"
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+	"go.scj.io/samba-over-ntfs/tdb"
+)
+
+const (
+	// XAttrTDBFileName is the default name of the database maintained by
+	// Samba's vfs_xattr_tdb module within the Samba state directory.
+	XAttrTDBFileName = "xattr.tdb"
+)
+
+// ErrNoAttribute is returned when the requested extended attribute is not
+// present in an xattr_tdb database.
+var ErrNoAttribute = errors.New("Extended attribute not found in xattr_tdb database")
+
+// FileID identifies a file within an xattr_tdb database. Samba derives it from
+// the device and inode numbers reported by stat.
+type FileID struct {
+	Device uint64
+	Inode  uint64
+}
+
+// Key returns the database key for the file, which matches the encoding of
+// push_file_id_16 in Samba.
+func (id FileID) Key() []byte {
+	key := make([]byte, 16)
+	binary.LittleEndian.PutUint64(key[0:8], id.Device)
+	binary.LittleEndian.PutUint64(key[8:16], id.Inode)
+	return key
+}
+
+// XAttr is a single named extended attribute.
+type XAttr struct {
+	Name  string
+	Value []byte
+}
+
+// XAttrList is the set of extended attributes stored for a single file in an
+// xattr_tdb database.
+//
+// See the definition of tdb_xattrs in samba/librpc/idl/xattr.idl
+type XAttrList []XAttr
+
+// Get returns the value of the named attribute and whether it was present.
+func (l XAttrList) Get(name string) ([]byte, bool) {
+	for _, xa := range l {
+		if xa.Name == name {
+			return xa.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set adds the named attribute to the list or replaces its existing value.
+func (l XAttrList) Set(name string, value []byte) XAttrList {
+	for i := range l {
+		if l[i].Name == name {
+			l[i].Value = value
+			return l
+		}
+	}
+	return append(l, XAttr{Name: name, Value: value})
+}
+
+// Remove deletes the named attribute from the list. It returns the modified
+// list and whether the attribute was present.
+func (l XAttrList) Remove(name string) (XAttrList, bool) {
+	for i := range l {
+		if l[i].Name == name {
+			return append(l[:i], l[i+1:]...), true
+		}
+	}
+	return l, false
+}
+
+// MarshalBinary writes the attribute list according to a Samba NDR data
+// layout.
+func (l XAttrList) MarshalBinary() (data []byte, err error) {
+	e := ndr.NewEncoder()
+	e.Uint32(uint32(len(l)))
+	for _, xa := range l {
+		// Each xattr_EA is a null terminated UTF-8 name followed by the value
+		// as a data blob
+		e.Align(4)
+		e.NullTermString(xa.Name)
+		e.DataBlob(xa.Value)
+	}
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary reads an attribute list from a byte slice containing
+// tdb_xattrs data formatted according to a Samba NDR data layout.
+func (l *XAttrList) UnmarshalBinary(data []byte) (err error) {
+	d := ndr.NewDecoder(data)
+	count := d.Uint32()
+	if uint64(count)*5 > uint64(len(data)) {
+		return ndr.ErrTruncated
+	}
+	list := make(XAttrList, 0, count)
+	for i := uint32(0); i < count && d.Err() == nil; i++ {
+		d.Align(4)
+		name := d.NullTermString()
+		value := d.DataBlob()
+		list = append(list, XAttr{Name: name, Value: value})
+	}
+	if err = d.Err(); err != nil {
+		return
+	}
+	*l = list
+	return nil
+}
+
+// XAttrTDB provides access to the extended attributes that Samba's
+// vfs_xattr_tdb module keeps in a TDB file on file systems that lack
+// extended attribute support.
+type XAttrTDB struct {
+	db *tdb.DB
+}
+
+// OpenXAttrTDB opens the xattr_tdb database at the given path. The flag must
+// be os.O_RDONLY or os.O_RDWR.
+func OpenXAttrTDB(path string, flag int) (*XAttrTDB, error) {
+	db, err := tdb.Open(path, flag)
+	if err != nil {
+		return nil, err
+	}
+	return &XAttrTDB{db}, nil
+}
+
+// Close closes the underlying database.
+func (x *XAttrTDB) Close() error {
+	return x.db.Close()
+}
+
+// ReadAttributes returns every extended attribute stored for the given file.
+func (x *XAttrTDB) ReadAttributes(id FileID) (XAttrList, error) {
+	data, err := x.db.Fetch(id.Key())
+	if err == tdb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list XAttrList
+	if err = list.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// WriteAttributes replaces every extended attribute stored for the given file.
+// An empty list removes the file's record from the database.
+func (x *XAttrTDB) WriteAttributes(id FileID, list XAttrList) error {
+	if len(list) == 0 {
+		err := x.db.Delete(id.Key())
+		if err == tdb.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	data, err := list.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return x.db.Store(id.Key(), data)
+}
+
+// ReadAttribute returns the bytes in the given attribute for the requested
+// file.
+func (x *XAttrTDB) ReadAttribute(id FileID, attr string) ([]byte, error) {
+	list, err := x.ReadAttributes(id)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := list.Get(attr)
+	if !ok {
+		return nil, ErrNoAttribute
+	}
+	return value, nil
+}
+
+// WriteAttribute will write binary data to the specified file within
+// a particular extended attribute. Existing data will be overwritten.
+func (x *XAttrTDB) WriteAttribute(id FileID, attr string, data []byte) error {
+	list, err := x.ReadAttributes(id)
+	if err != nil {
+		return err
+	}
+	return x.WriteAttributes(id, list.Set(attr, data))
+}
+
+// RemoveAttribute removes an extended attribute from the specified file.
+func (x *XAttrTDB) RemoveAttribute(id FileID, attr string) error {
+	list, err := x.ReadAttributes(id)
+	if err != nil {
+		return err
+	}
+	list, ok := list.Remove(attr)
+	if !ok {
+		return ErrNoAttribute
+	}
+	return x.WriteAttributes(id, list)
+}
+
+// ReadRawSD will return the raw Samba security descriptor bytes for the
+// requested file.
+func (x *XAttrTDB) ReadRawSD(id FileID) ([]byte, error) {
+	return x.ReadAttribute(id, AttributeName)
+}
+
+// ReadSD will return the security descriptor for the requested file.
+func (x *XAttrTDB) ReadSD(id FileID) (*ntsecurity.SecurityDescriptor, error) {
+	bytes, err := x.ReadRawSD(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var sd SecurityDescriptor
+	err = sd.UnmarshalBinary(bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return sd.SecurityDescriptor, nil
+}
+
+// Traverse calls fn for every file in the database along with its extended
+// attributes. Traversal stops at the first non-nil error returned by fn.
+func (x *XAttrTDB) Traverse(fn func(id FileID, list XAttrList) error) error {
+	return x.db.Traverse(func(key []byte, data []byte) error {
+		if len(key) != 16 {
+			return nil // Not a file record
+		}
+		id := FileID{
+			Device: binary.LittleEndian.Uint64(key[0:8]),
+			Inode:  binary.LittleEndian.Uint64(key[8:16]),
+		}
+		var list XAttrList
+		if err := list.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		return fn(id, list)
+	})
+}
@@ -0,0 +1,56 @@
+package sambasecurity
+
+import (
+	"syscall"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+// FileIDFromPath returns the xattr_tdb identifier for the file at the given
+// path.
+//
+// The identifier is only meaningful for a database written by a Samba server
+// that saw the same device and inode numbers, so the file system must be
+// mounted on the same device it was shared from.
+func FileIDFromPath(path string) (FileID, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return FileID{}, err
+	}
+	return FileID{Device: uint64(st.Dev), Inode: uint64(st.Ino)}, nil
+}
+
+// ReadFileRawSD will return the raw Samba security descriptor bytes for the
+// requested file.
+func (x *XAttrTDB) ReadFileRawSD(path string) ([]byte, error) {
+	return x.ReadFileAttribute(path, AttributeName)
+}
+
+// ReadFileSD will return the security descriptor for the requested file.
+func (x *XAttrTDB) ReadFileSD(path string) (*ntsecurity.SecurityDescriptor, error) {
+	id, err := FileIDFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return x.ReadSD(id)
+}
+
+// ReadFileAttribute will return the bytes in the given attribute for the
+// requested file.
+func (x *XAttrTDB) ReadFileAttribute(path string, attr string) ([]byte, error) {
+	id, err := FileIDFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return x.ReadAttribute(id, attr)
+}
+
+// WriteFileAttribute will write binary data to the specified file within
+// a particular extended attribute. Existing data will be overwritten.
+func (x *XAttrTDB) WriteFileAttribute(path string, attr string, data []byte) error {
+	id, err := FileIDFromPath(path)
+	if err != nil {
+		return err
+	}
+	return x.WriteAttribute(id, attr, data)
+}
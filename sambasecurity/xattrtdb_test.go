@@ -0,0 +1,97 @@
+package sambasecurity
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testdata/xattr.tdb has the on-disk layout that libtdb gives a database
+// opened with TDB_DEFAULT, as vfs_xattr_tdb opens it, so records are hashed
+// with the original TDB hash. It was assembled from tdb_private.h and
+// xattr.idl by a standalone script rather than by Samba, since no tdbtool was
+// available to create one.
+var (
+	fixtureFile1 = FileID{Device: 0x803, Inode: 131073}
+	fixtureFile2 = FileID{Device: 0x803, Inode: 131074}
+)
+
+func TestXAttrTDBRead(t *testing.T) {
+	x, err := OpenXAttrTDB("testdata/xattr.tdb", os.O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+
+	value, err := x.ReadAttribute(fixtureFile1, "user.DOSATTRIB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(value, []byte("0x20\x00")) {
+		t.Errorf("user.DOSATTRIB = %q", value)
+	}
+	sd, err := x.ReadSD(fixtureFile1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.DACL == nil || len(sd.DACL.Entries) != 4 {
+		t.Errorf("security.NTACL has an unexpected DACL: %s", sd.SDDL())
+	}
+	if _, err = x.ReadAttribute(fixtureFile2, AttributeName); err != ErrNoAttribute {
+		t.Errorf("ReadAttribute of a missing attribute returned %v", err)
+	}
+
+	files := 0
+	err = x.Traverse(func(id FileID, list XAttrList) error {
+		files++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 2 {
+		t.Errorf("Traverse visited %d files, want 2", files)
+	}
+}
+
+func TestXAttrTDBWrite(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/xattr.tdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "xattrtdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, XAttrTDBFileName)
+	if err = ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := OpenXAttrTDB(path, os.O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = x.WriteAttribute(fixtureFile2, "user.comment", []byte("goodbye")); err != nil {
+		t.Fatal(err)
+	}
+	x.Close()
+
+	if x, err = OpenXAttrTDB(path, os.O_RDONLY); err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	value, err := x.ReadAttribute(fixtureFile2, "user.comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "goodbye" {
+		t.Errorf("user.comment = %q after writing", value)
+	}
+	if _, err = x.ReadAttribute(fixtureFile1, "user.DOSATTRIB"); err != nil {
+		t.Errorf("Other file lost its attributes: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package sambasecurity
+
+import (
+	"errors"
+
+	"go.scj.io/samba-over-ntfs/ntsecurity"
+)
+
+var errFileIDUnsupported = errors.New("Reading xattr_tdb file identifiers on Windows is not supported")
+
+// FileIDFromPath returns the xattr_tdb identifier for the file at the given
+// path.
+func FileIDFromPath(path string) (FileID, error) {
+	return FileID{}, errFileIDUnsupported
+}
+
+// ReadFileRawSD will return the raw Samba security descriptor bytes for the
+// requested file.
+func (x *XAttrTDB) ReadFileRawSD(path string) ([]byte, error) {
+	return x.ReadFileAttribute(path, AttributeName)
+}
+
+// ReadFileSD will return the security descriptor for the requested file.
+func (x *XAttrTDB) ReadFileSD(path string) (*ntsecurity.SecurityDescriptor, error) {
+	id, err := FileIDFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return x.ReadSD(id)
+}
+
+// ReadFileAttribute will return the bytes in the given attribute for the
+// requested file.
+func (x *XAttrTDB) ReadFileAttribute(path string, attr string) ([]byte, error) {
+	id, err := FileIDFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return x.ReadAttribute(id, attr)
+}
+
+// WriteFileAttribute will write binary data to the specified file within
+// a particular extended attribute. Existing data will be overwritten.
+func (x *XAttrTDB) WriteFileAttribute(path string, attr string, data []byte) error {
+	id, err := FileIDFromPath(path)
+	if err != nil {
+		return err
+	}
+	return x.WriteAttribute(id, attr, data)
+}
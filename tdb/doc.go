@@ -0,0 +1,15 @@
+/*
+Package tdb provides read and write access to trivial database (TDB) files,
+the simple key/value store used throughout Samba.
+
+The package reads the on-disk format directly and does not depend on libtdb.
+It honors the byte order recorded in the file header and supports both the
+original TDB hash function and the Jenkins hash used by databases created
+with TDB_INCOMPATIBLE_HASH.
+
+Writes take the same fcntl locks that libtdb uses for a database-wide lock,
+so they will wait for (and exclude) other well-behaved TDB users. Databases
+that use robust mutexes or that contain an unfinished transaction are not
+supported; they should be repaired with tdbtool or smbd first.
+*/
+package tdb
@@ -0,0 +1,19 @@
+package tdb
+
+import "testing"
+
+func TestJenkinsHash(t *testing.T) {
+	// Test vectors from the driver of lookup3.c, with an initial value of 0
+	tests := []struct {
+		key  string
+		hash uint32
+	}{
+		{"", 0xdeadbeef},
+		{"Four score and seven years ago", 0x17770551},
+	}
+	for _, tt := range tests {
+		if hash := JenkinsHash([]byte(tt.key)); hash != tt.hash {
+			t.Errorf("JenkinsHash(%q) = %#08x, want %#08x", tt.key, hash, tt.hash)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package tdb
+
+import "syscall"
+
+// lockAll takes the fcntl byte range lock that libtdb uses for
+// tdb_lockall, which covers every hash chain and record in the database. It
+// waits for conflicting locks held by other processes to be released.
+func (db *DB) lockAll(write bool) error {
+	lock := syscall.Flock_t{
+		Type:   syscall.F_RDLCK,
+		Whence: 0,
+		Start:  freelistTop,
+		Len:    0, // Through the end of the file
+	}
+	if write {
+		lock.Type = syscall.F_WRLCK
+	}
+	return syscall.FcntlFlock(db.file.Fd(), syscall.F_SETLKW, &lock)
+}
+
+// unlockAll releases the lock taken by lockAll.
+func (db *DB) unlockAll() error {
+	lock := syscall.Flock_t{
+		Type:   syscall.F_UNLCK,
+		Whence: 0,
+		Start:  freelistTop,
+		Len:    0,
+	}
+	return syscall.FcntlFlock(db.file.Fd(), syscall.F_SETLK, &lock)
+}
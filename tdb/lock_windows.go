@@ -0,0 +1,12 @@
+package tdb
+
+// lockAll is a no-op on Windows, where TDB files are never shared with a
+// running Samba server.
+func (db *DB) lockAll(write bool) error {
+	return nil
+}
+
+// unlockAll is a no-op on Windows.
+func (db *DB) unlockAll() error {
+	return nil
+}
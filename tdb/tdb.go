@@ -0,0 +1,571 @@
+package tdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+const (
+	// DefaultHashSize is the number of hash chains used by Create when no
+	// size is specified. It matches TDB_DEFAULT_HASH_SIZE.
+	DefaultHashSize = 131
+)
+
+var (
+	// ErrNotFound is returned when a key is not present in the database.
+	ErrNotFound = errors.New("TDB record not found")
+	// ErrReadOnly is returned when attempting to modify a database that was
+	// opened read-only.
+	ErrReadOnly = errors.New("TDB database is read-only")
+	// ErrCorrupt is returned when the database structure is inconsistent.
+	ErrCorrupt = errors.New("TDB data has been corrupted or truncated")
+)
+
+// DB is an open trivial database file.
+//
+// A DB is not safe for concurrent use by multiple goroutines.
+type DB struct {
+	file     *os.File
+	order    binary.ByteOrder
+	hash     HashFunc
+	header   header
+	readOnly bool
+}
+
+// Open opens the TDB file at the given path. The flag must be os.O_RDONLY or
+// os.O_RDWR.
+func Open(path string, flag int) (*DB, error) {
+	file, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{
+		file:     file,
+		readOnly: flag&(os.O_WRONLY|os.O_RDWR) == 0,
+	}
+	if err = db.readHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Create creates a new, empty TDB file at the given path with the requested
+// number of hash chains. If hashSize is zero DefaultHashSize is used. Create
+// fails if the file already exists.
+//
+// New databases use the original TDB hash function and the byte order of the
+// host, which is what libtdb does when TDB_INCOMPATIBLE_HASH is not requested.
+func Create(path string, hashSize uint32) (*DB, error) {
+	if hashSize == 0 {
+		hashSize = DefaultHashSize
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{
+		file:  file,
+		order: hostByteOrder(),
+		hash:  DefaultHash,
+	}
+	db.header.Version = version
+	db.header.HashSize = hashSize
+	db.header.Magic1Hash, db.header.Magic2Hash = db.magicHashes(DefaultHash)
+
+	data := make([]byte, dataStart(hashSize))
+	copy(data, db.header.marshal(db.order))
+	if _, err = file.WriteAt(data, 0); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close closes the database file.
+func (db *DB) Close() error {
+	return db.file.Close()
+}
+
+// HashSize returns the number of hash chains in the database.
+func (db *DB) HashSize() uint32 {
+	return db.header.HashSize
+}
+
+// Fetch returns the data stored under the given key. If the key is not present
+// ErrNotFound is returned.
+func (db *DB) Fetch(key []byte) (data []byte, err error) {
+	if err = db.lockAll(false); err != nil {
+		return
+	}
+	defer db.unlockAll()
+
+	_, offset, rec, err := db.find(key)
+	if err != nil {
+		return
+	}
+	data = make([]byte, rec.DataLength)
+	err = db.readAt(data, offset+recordFixedBytes+int64(rec.KeyLength))
+	return
+}
+
+// Store writes the data under the given key, replacing any existing record.
+func (db *DB) Store(key []byte, data []byte) (err error) {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if err = db.lockAll(true); err != nil {
+		return
+	}
+	defer db.unlockAll()
+
+	if err = db.remove(key); err != nil && err != ErrNotFound {
+		return
+	}
+	return db.append(key, data)
+}
+
+// Delete removes the record stored under the given key. If the key is not
+// present ErrNotFound is returned.
+func (db *DB) Delete(key []byte) (err error) {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if err = db.lockAll(true); err != nil {
+		return
+	}
+	defer db.unlockAll()
+
+	return db.remove(key)
+}
+
+// Traverse calls fn for every record in the database. Traversal stops at the
+// first non-nil error returned by fn, which is then returned by Traverse.
+//
+// The database is locked for the duration of the traversal, so fn must not
+// modify it.
+func (db *DB) Traverse(fn func(key []byte, data []byte) error) (err error) {
+	if err = db.lockAll(false); err != nil {
+		return
+	}
+	defer db.unlockAll()
+
+	size, err := db.size()
+	if err != nil {
+		return
+	}
+	limit := recordLimit(size)
+	for bucket := uint32(0); bucket < db.header.HashSize; bucket++ {
+		offset, err := db.readOffset(hashTop(bucket, db.header.HashSize))
+		if err != nil {
+			return err
+		}
+		for i := 0; offset != 0; i++ {
+			if i > limit {
+				return ErrCorrupt
+			}
+			var rec record
+			if rec, err = db.readChainRecord(offset, size); err != nil {
+				return err
+			}
+			if rec.Magic == recordMagic {
+				buf := make([]byte, rec.KeyLength+rec.DataLength)
+				if err = db.readAt(buf, offset+recordFixedBytes); err != nil {
+					return err
+				}
+				if err = fn(buf[:rec.KeyLength], buf[rec.KeyLength:]); err != nil {
+					return err
+				}
+			}
+			offset = int64(rec.Next)
+		}
+	}
+	return nil
+}
+
+func (db *DB) readHeader() error {
+	buf := make([]byte, headerFixedBytes)
+	if err := db.readAt(buf, 0); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(buf, []byte(magicFood)) {
+		return errors.New("Not a TDB file: Invalid magic")
+	}
+	switch {
+	case binary.LittleEndian.Uint32(buf[32:36]) == version:
+		db.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(buf[32:36]) == version:
+		db.order = binary.BigEndian
+	default:
+		return errors.New("Unsupported TDB version")
+	}
+	db.header.unmarshal(buf, db.order)
+	if db.header.HashSize == 0 {
+		return ErrCorrupt
+	}
+
+	switch db.header.RWLocks {
+	case 0:
+	case hashRWLockMagic:
+		// libtdb tags databases created with TDB_INCOMPATIBLE_HASH this way
+		// so that versions that predate hash signatures refuse to open them
+		db.hash = JenkinsHash
+	case featureFlagMagic:
+		if db.header.FeatureFlags&featureMutex != 0 {
+			return errors.New("TDB files with mutex locking are not supported")
+		}
+	default:
+		return errors.New("TDB files with spinlocks are not supported")
+	}
+
+	// Determine the hash function from the signature stored in the header
+	switch {
+	case db.hash != nil:
+		magic1, magic2 := db.magicHashes(db.hash)
+		if magic1 != db.header.Magic1Hash || magic2 != db.header.Magic2Hash {
+			return errors.New("TDB file hash signature does not match its hash function")
+		}
+	case db.header.Magic1Hash == 0 && db.header.Magic2Hash == 0:
+		db.hash = DefaultHash
+	default:
+		for _, fn := range []HashFunc{DefaultHash, JenkinsHash} {
+			magic1, magic2 := db.magicHashes(fn)
+			if magic1 == db.header.Magic1Hash && magic2 == db.header.Magic2Hash {
+				db.hash = fn
+				break
+			}
+		}
+		if db.hash == nil {
+			return errors.New("TDB file uses an unknown hash function")
+		}
+	}
+
+	// An interrupted transaction leaves a valid recovery record behind, which
+	// libtdb replays the next time the database is opened for writing
+	if db.header.RecoveryStart != 0 {
+		rec, err := db.readRecord(int64(db.header.RecoveryStart))
+		if err == nil && rec.Magic == recoveryMagic {
+			return errors.New("TDB file has a pending transaction recovery")
+		}
+	}
+	return nil
+}
+
+// magicHashes returns the header hash signature for the given hash function.
+func (db *DB) magicHashes(fn HashFunc) (magic1, magic2 uint32) {
+	// See tdb_header_hash in samba/lib/tdb/common/open.c
+	var m [4]byte
+	db.order.PutUint32(m[:], recordMagic)
+	magic1 = fn([]byte(magicFood + "\x00"))
+	magic2 = fn(m[:])
+	if magic1 == 0 && magic2 == 0 {
+		magic1 = 1
+	}
+	return
+}
+
+// find locates the record for the given key. It returns the offset of the
+// pointer that refers to the record, the offset of the record itself and the
+// decoded record header.
+func (db *DB) find(key []byte) (ptr int64, offset int64, rec record, err error) {
+	size, err := db.size()
+	if err != nil {
+		return
+	}
+	hash := db.hash(key)
+	ptr = hashTop(hash, db.header.HashSize)
+	if offset, err = db.readOffset(ptr); err != nil {
+		return
+	}
+	limit := recordLimit(size)
+	for i := 0; offset != 0; i++ {
+		if i > limit {
+			err = ErrCorrupt
+			return
+		}
+		if rec, err = db.readChainRecord(offset, size); err != nil {
+			return
+		}
+		if rec.Magic == recordMagic && rec.FullHash == hash && rec.KeyLength == uint32(len(key)) {
+			k := make([]byte, rec.KeyLength)
+			if err = db.readAt(k, offset+recordFixedBytes); err != nil {
+				return
+			}
+			if bytes.Equal(k, key) {
+				return
+			}
+		}
+		ptr = offset // The next pointer is the first member of the record
+		offset = int64(rec.Next)
+	}
+	err = ErrNotFound
+	return
+}
+
+// remove unlinks the record for the given key from its hash chain and places
+// it on the free list.
+func (db *DB) remove(key []byte) error {
+	ptr, offset, rec, err := db.find(key)
+	if err != nil {
+		return err
+	}
+	if err = db.writeOffset(ptr, int64(rec.Next)); err != nil {
+		return err
+	}
+	return db.free(offset, rec)
+}
+
+// free places the record on the free list, merging it with the free records
+// that adjoin it on either side as tdb_free does.
+func (db *DB) free(offset int64, rec record) error {
+	size, err := db.size()
+	if err != nil {
+		return err
+	}
+
+	right := offset + recordFixedBytes + int64(rec.Length)
+	if right+recordFixedBytes <= size {
+		next, err := db.readRecord(right)
+		if err != nil {
+			return err
+		}
+		if next.Magic == freeMagic {
+			if err = db.unlinkFree(right, size); err != nil {
+				return err
+			}
+			rec.Length += recordFixedBytes + next.Length
+		}
+	}
+
+	if offset-offsetBytes >= dataStart(db.header.HashSize) {
+		total, err := db.readOffset(offset - offsetBytes)
+		if err != nil {
+			return err
+		}
+		left := offset - total
+		if total >= recordFixedBytes+offsetBytes && left >= dataStart(db.header.HashSize) {
+			prev, err := db.readRecord(left)
+			if err != nil {
+				return err
+			}
+			if prev.Magic == freeMagic && left+recordFixedBytes+int64(prev.Length) == offset {
+				if err = db.unlinkFree(left, size); err != nil {
+					return err
+				}
+				offset = left
+				rec.Length += recordFixedBytes + prev.Length
+			}
+		}
+	}
+
+	return db.pushFree(offset, rec)
+}
+
+// pushFree places the record at the head of the free list.
+func (db *DB) pushFree(offset int64, rec record) error {
+	head, err := db.readOffset(freelistTop)
+	if err != nil {
+		return err
+	}
+	rec.Next = uint32(head)
+	rec.Magic = freeMagic
+	if err = db.writeRecord(offset, rec); err != nil {
+		return err
+	}
+	return db.writeOffset(freelistTop, offset)
+}
+
+// unlinkFree removes the free record at the given offset from the free list.
+func (db *DB) unlinkFree(target int64, size int64) error {
+	ptr := int64(freelistTop)
+	limit := recordLimit(size)
+	for i := 0; ; i++ {
+		if i > limit {
+			return ErrCorrupt
+		}
+		offset, err := db.readOffset(ptr)
+		if err != nil {
+			return err
+		}
+		if offset == 0 {
+			return ErrCorrupt
+		}
+		rec, err := db.readRecord(offset)
+		if err != nil {
+			return err
+		}
+		if offset == target {
+			return db.writeOffset(ptr, int64(rec.Next))
+		}
+		ptr = offset
+	}
+}
+
+// allocate returns the offset of space for a record with the given length
+// following its header, and the length that the record is given. The first
+// free record that is large enough is used, and split if the rest of it can
+// form a record of its own. The file is extended when no free record fits.
+func (db *DB) allocate(length uint32) (int64, uint32, error) {
+	size, err := db.size()
+	if err != nil {
+		return 0, 0, err
+	}
+	ptr := int64(freelistTop)
+	limit := recordLimit(size)
+	for i := 0; ; i++ {
+		if i > limit {
+			return 0, 0, ErrCorrupt
+		}
+		offset, err := db.readOffset(ptr)
+		if err != nil {
+			return 0, 0, err
+		}
+		if offset == 0 {
+			break
+		}
+		rec, err := db.readRecord(offset)
+		if err != nil {
+			return 0, 0, err
+		}
+		if rec.Magic != freeMagic || offset+recordFixedBytes+int64(rec.Length) > size {
+			return 0, 0, ErrCorrupt
+		}
+		if rec.Length < length {
+			ptr = offset
+			continue
+		}
+		if err = db.writeOffset(ptr, int64(rec.Next)); err != nil {
+			return 0, 0, err
+		}
+		if rec.Length-length < minRecordBytes {
+			return offset, rec.Length, nil
+		}
+		rest := record{Length: rec.Length - length - recordFixedBytes}
+		if err = db.pushFree(offset+recordFixedBytes+int64(length), rest); err != nil {
+			return 0, 0, err
+		}
+		return offset, length, nil
+	}
+
+	offset := (size + alignment - 1) &^ (alignment - 1)
+	if offset+recordFixedBytes+int64(length) > 0xffffffff {
+		return 0, 0, errors.New("TDB file is too large to hold the record")
+	}
+	return offset, length, nil
+}
+
+// append writes a new record, in free space if there is enough and otherwise
+// at the end of the file, and links it at the head of its hash chain.
+func (db *DB) append(key []byte, data []byte) error {
+	length := (len(key) + len(data) + offsetBytes + alignment - 1) &^ (alignment - 1)
+	if length > 0xffffffff-recordFixedBytes {
+		return errors.New("TDB file is too large to hold the record")
+	}
+	offset, allocated, err := db.allocate(uint32(length))
+	if err != nil {
+		return err
+	}
+
+	hash := db.hash(key)
+	head, err := db.readOffset(hashTop(hash, db.header.HashSize))
+	if err != nil {
+		return err
+	}
+	rec := record{
+		Next:       uint32(head),
+		Length:     allocated,
+		KeyLength:  uint32(len(key)),
+		DataLength: uint32(len(data)),
+		FullHash:   hash,
+		Magic:      recordMagic,
+	}
+	buf := make([]byte, recordFixedBytes+int(allocated))
+	rec.marshal(buf, db.order)
+	copy(buf[recordFixedBytes:], key)
+	copy(buf[recordFixedBytes+len(key):], data)
+	db.order.PutUint32(buf[len(buf)-offsetBytes:], uint32(len(buf))) // Tailer
+	if _, err = db.file.WriteAt(buf, offset); err != nil {
+		return err
+	}
+	return db.writeOffset(hashTop(hash, db.header.HashSize), offset)
+}
+
+func (db *DB) readAt(buf []byte, offset int64) error {
+	n, err := db.file.ReadAt(buf, offset)
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil {
+		err = ErrCorrupt
+	}
+	return err
+}
+
+func (db *DB) readOffset(offset int64) (int64, error) {
+	var buf [offsetBytes]byte
+	if err := db.readAt(buf[:], offset); err != nil {
+		return 0, err
+	}
+	return int64(db.order.Uint32(buf[:])), nil
+}
+
+func (db *DB) writeOffset(offset int64, value int64) error {
+	var buf [offsetBytes]byte
+	db.order.PutUint32(buf[:], uint32(value))
+	_, err := db.file.WriteAt(buf[:], offset)
+	return err
+}
+
+func (db *DB) readRecord(offset int64) (rec record, err error) {
+	var buf [recordFixedBytes]byte
+	if err = db.readAt(buf[:], offset); err != nil {
+		return
+	}
+	rec.unmarshal(buf[:], db.order)
+	return
+}
+
+// writeRecord writes the record header and the tailer that trails it.
+func (db *DB) writeRecord(offset int64, rec record) (err error) {
+	var buf [recordFixedBytes]byte
+	rec.marshal(buf[:], db.order)
+	if _, err = db.file.WriteAt(buf[:], offset); err != nil {
+		return
+	}
+	total := int64(recordFixedBytes) + int64(rec.Length)
+	return db.writeOffset(offset+total-offsetBytes, total)
+}
+
+// readChainRecord reads the header of a record found in a hash chain and
+// checks that it is a record of a key, and that the record and its key and
+// data lie within a file of the given size, so that corrupted lengths are not
+// trusted.
+func (db *DB) readChainRecord(offset int64, size int64) (rec record, err error) {
+	if rec, err = db.readRecord(offset); err != nil {
+		return
+	}
+	if !rec.live() ||
+		offset+recordFixedBytes+int64(rec.Length) > size ||
+		uint64(rec.KeyLength)+uint64(rec.DataLength) > uint64(rec.Length) {
+		err = ErrCorrupt
+	}
+	return
+}
+
+// size returns the size of the file.
+func (db *DB) size() (int64, error) {
+	fi, err := db.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// recordLimit returns an upper bound for the number of records in a file of
+// the given size, which is used to detect loops in corrupted lists.
+func recordLimit(size int64) int {
+	return int(size/recordFixedBytes) + 1
+}
@@ -0,0 +1,114 @@
+package tdb
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The testdata/*.tdb fixtures hold the records key1 and key2 followed by free
+// space, in databases created without and with TDB_INCOMPATIBLE_HASH. They
+// were assembled from tdb_private.h by a standalone script rather than by
+// libtdb.
+
+func TestOpen(t *testing.T) {
+	for _, name := range []string{"default_hash.tdb", "incompatible_hash.tdb"} {
+		db, err := Open(filepath.Join("testdata", name), os.O_RDONLY)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		data, err := db.Fetch([]byte("key2"))
+		if err != nil || string(data) != "value2" {
+			t.Errorf("%s: Fetch returned %q, %v", name, data, err)
+		}
+		db.Close()
+	}
+}
+
+// openCopy opens a writable copy of the fixture.
+func openCopy(t *testing.T, name string) (*DB, func()) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "tdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, data, 0600); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	db, err := Open(path, os.O_RDWR)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStoreReusesFreeRecords(t *testing.T) {
+	db, done := openCopy(t, "default_hash.tdb")
+	defer done()
+	before, err := db.size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err = db.Store([]byte("key1"), []byte("value1b")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both records and the free space after them merge into a single free
+	// record, which is large enough to hold the new one
+	if err = db.Delete([]byte("key1")); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Delete([]byte("key2")); err != nil {
+		t.Fatal(err)
+	}
+	value := strings.Repeat("x", 300)
+	if err = db.Store([]byte("key3"), []byte(value)); err != nil {
+		t.Fatal(err)
+	}
+	after, err := db.size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("File grew from %d to %d bytes", before, after)
+	}
+	data, err := db.Fetch([]byte("key3"))
+	if err != nil || string(data) != value {
+		t.Errorf("Fetch returned %q, %v", data, err)
+	}
+	if _, err = db.Fetch([]byte("key1")); err != ErrNotFound {
+		t.Errorf("Fetch of a deleted key returned %v", err)
+	}
+}
+
+func TestCorruptLength(t *testing.T) {
+	db, done := openCopy(t, "default_hash.tdb")
+	defer done()
+	_, offset, _, err := db.find([]byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], 0x7fffffff)
+	if _, err = db.file.WriteAt(buf[:], offset+12); err != nil { // DataLength
+		t.Fatal(err)
+	}
+	if _, err = db.Fetch([]byte("key1")); err != ErrCorrupt {
+		t.Errorf("Fetch of a record with a corrupted length returned %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package tdb
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// See samba/lib/tdb/common/tdb_private.h for the definitions of the
+// structures and constants in this file.
+
+const (
+	magicFood = "TDB file\n"
+
+	version = 0x26011967 + 6
+
+	recordMagic   = 0x26011999
+	freeMagic     = ^uint32(recordMagic)
+	deadMagic     = 0xFEE1DEAD
+	recoveryMagic = 0xf53bc0e7
+
+	hashRWLockMagic  = 0xbad1a51
+	featureFlagMagic = 0xbad1a52
+	featureMutex     = 0x1
+
+	headerFixedBytes = 32 + 4*9 + 4*25
+	recordFixedBytes = 4 * 6
+	offsetBytes      = 4
+	alignment        = 4
+
+	// minRecordBytes is the smallest record that a free record is split to
+	// leave behind, as MIN_REC_SIZE.
+	minRecordBytes = recordFixedBytes + offsetBytes + 8
+
+	// freelistTop is the offset of the head of the free list, which is
+	// immediately followed by the heads of the hash chains.
+	freelistTop = headerFixedBytes
+)
+
+// header is the decoded form of the tdb_header structure at the start of
+// every database.
+type header struct {
+	Version        uint32
+	HashSize       uint32
+	RWLocks        uint32
+	RecoveryStart  uint32
+	SequenceNumber uint32
+	Magic1Hash     uint32
+	Magic2Hash     uint32
+	FeatureFlags   uint32
+	MutexSize      uint32
+}
+
+func (h *header) unmarshal(b []byte, order binary.ByteOrder) {
+	h.Version = order.Uint32(b[32:36])
+	h.HashSize = order.Uint32(b[36:40])
+	h.RWLocks = order.Uint32(b[40:44])
+	h.RecoveryStart = order.Uint32(b[44:48])
+	h.SequenceNumber = order.Uint32(b[48:52])
+	h.Magic1Hash = order.Uint32(b[52:56])
+	h.Magic2Hash = order.Uint32(b[56:60])
+	h.FeatureFlags = order.Uint32(b[60:64])
+	h.MutexSize = order.Uint32(b[64:68])
+}
+
+func (h *header) marshal(order binary.ByteOrder) []byte {
+	b := make([]byte, headerFixedBytes)
+	copy(b[0:32], magicFood)
+	order.PutUint32(b[32:36], h.Version)
+	order.PutUint32(b[36:40], h.HashSize)
+	order.PutUint32(b[40:44], h.RWLocks)
+	order.PutUint32(b[44:48], h.RecoveryStart)
+	order.PutUint32(b[48:52], h.SequenceNumber)
+	order.PutUint32(b[52:56], h.Magic1Hash)
+	order.PutUint32(b[56:60], h.Magic2Hash)
+	order.PutUint32(b[60:64], h.FeatureFlags)
+	order.PutUint32(b[64:68], h.MutexSize)
+	return b
+}
+
+// record is the decoded form of the tdb_record structure that precedes every
+// key and value stored in the database.
+//
+// Length counts every byte that follows the record header, including the key,
+// the data, any padding and the four byte tailer at the end of the record.
+type record struct {
+	Next       uint32
+	Length     uint32
+	KeyLength  uint32
+	DataLength uint32
+	FullHash   uint32
+	Magic      uint32
+}
+
+func (r *record) unmarshal(b []byte, order binary.ByteOrder) {
+	r.Next = order.Uint32(b[0:4])
+	r.Length = order.Uint32(b[4:8])
+	r.KeyLength = order.Uint32(b[8:12])
+	r.DataLength = order.Uint32(b[12:16])
+	r.FullHash = order.Uint32(b[16:20])
+	r.Magic = order.Uint32(b[20:24])
+}
+
+// live returns true if the record may be found in a hash chain. Deleted
+// records are either moved to the free list or, when libtdb keeps them in
+// place, marked as dead.
+func (r *record) live() bool {
+	return r.Magic == recordMagic || r.Magic == deadMagic
+}
+
+func (r *record) marshal(b []byte, order binary.ByteOrder) {
+	order.PutUint32(b[0:4], r.Next)
+	order.PutUint32(b[4:8], r.Length)
+	order.PutUint32(b[8:12], r.KeyLength)
+	order.PutUint32(b[12:16], r.DataLength)
+	order.PutUint32(b[16:20], r.FullHash)
+	order.PutUint32(b[20:24], r.Magic)
+}
+
+// hashTop returns the offset of the head of the hash chain for the given
+// hash value.
+func hashTop(hash uint32, hashSize uint32) int64 {
+	return freelistTop + int64(hash%hashSize+1)*offsetBytes
+}
+
+// dataStart returns the offset of the first byte following the hash table.
+func dataStart(hashSize uint32) int64 {
+	return freelistTop + int64(hashSize+1)*offsetBytes
+}
+
+// hostByteOrder returns the byte order of the machine, which libtdb uses for
+// newly created databases.
+func hostByteOrder() binary.ByteOrder {
+	var x uint16 = 1
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}